@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ClassSampleCounts returns the number of rows of every class that each tree
+// of a balanced random forest draws, as described by spec, from the rows idx
+// of the data. "under" draws as many rows of each class as there are in the
+// smallest class, "over" as many as there are in the largest one and a
+// number draws that many rows of each class. Otherwise spec is a comma
+// separated list of class:count pairs and the classes left out keep their
+// number of rows. Classes without rows in idx are never drawn
+func ClassSampleCounts(spec string, y []float64, idx []int, label Column) ([]int, error) {
+	rows := make([]int, len(label.levels))
+	for _, i := range idx {
+		rows[int(y[i])]++
+	}
+	smallest, largest := 0, 0
+	for _, cnt := range rows {
+		if cnt > 0 && (smallest == 0 || cnt < smallest) {
+			smallest = cnt
+		}
+		if cnt > largest {
+			largest = cnt
+		}
+	}
+
+	counts := make([]int, len(rows))
+	switch spec {
+	case "under":
+		copy(counts, rows)
+		for c := range counts {
+			if counts[c] > 0 {
+				counts[c] = smallest
+			}
+		}
+		return counts, nil
+	case "over":
+		for c := range counts {
+			if rows[c] > 0 {
+				counts[c] = largest
+			}
+		}
+		return counts, nil
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n <= 0 {
+			return nil, fmt.Errorf("bad number of rows per class %q", spec)
+		}
+		for c := range counts {
+			if rows[c] > 0 {
+				counts[c] = n
+			}
+		}
+		return counts, nil
+	}
+
+	copy(counts, rows)
+	for _, part := range SplitList(spec) {
+		sep := strings.LastIndexByte(part, ':')
+		if sep < 0 {
+			return nil, fmt.Errorf("bad class sample %q, expected under, over, a number or class:count", part)
+		}
+		class, ok := label.codes[strings.TrimSpace(part[:sep])]
+		if !ok {
+			return nil, fmt.Errorf("unknown class %q", part[:sep])
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(part[sep+1:]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad class sample %q", part)
+		}
+		if rows[class] > 0 {
+			counts[class] = n
+		}
+	}
+	return counts, nil
+}
+
+// Function to draw counts[c] rows of class c from train, with replacement,
+// so that the classes are represented as asked in the sample whatever their
+// share of train. The rows of train that were never drawn are returned as
+// the out-of-bag rows
+func balancedSample(train []int, y []float64, counts []int, rng *rand.Rand) ([]int, []int) {
+	byClass := make([][]int, len(counts))
+	for pos := range train {
+		c := int(y[train[pos]])
+		byClass[c] = append(byClass[c], pos)
+	}
+
+	var sample []int
+	drawn := make([]bool, len(train))
+	for c, positions := range byClass {
+		if len(positions) == 0 {
+			continue
+		}
+		for k := 0; k < counts[c]; k++ {
+			pos := positions[rng.Intn(len(positions))]
+			sample = append(sample, train[pos])
+			drawn[pos] = true
+		}
+	}
+	var oob []int
+	for pos, i := range train {
+		if !drawn[pos] {
+			oob = append(oob, i)
+		}
+	}
+	return sample, oob
+}
+
+// Function to print the number of rows of every class drawn by each tree
+func PrintClassSampleCounts(counts []int, label Column) {
+	fmt.Printf("%-20s %10s\n", "class", "rows")
+	for c, cnt := range counts {
+		if cnt > 0 {
+			fmt.Printf("%-20s %10d\n", label.level(float64(c)), cnt)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// Heap of the candidate splits, the one with the largest decrease in impurity first
+type candidateHeap []*splitCandidate
+
+func (h candidateHeap) Len() int           { return len(h) }
+func (h candidateHeap) Less(i, j int) bool { return h[i].decrease > h[j].decrease }
+func (h candidateHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *candidateHeap) Push(x interface{}) {
+	*h = append(*h, x.(*splitCandidate))
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Method of class Tree to build the decision tree best-first: the leaf whose
+// split brings the largest decrease in impurity is split next, until the tree
+// has maxLeafNodes leaves or no leaf can be split
+func (T *Tree) bestFirstBuildTree(X Matrix, y []float64, idx []int) DNode {
+	root := T.leafNode(y, idx)
+	h := &candidateHeap{}
+	if split := T.findSplit(X, y, idx, 0, &root); split != nil {
+		split.node = &root
+		heap.Push(h, split)
+	}
+
+	for leaves := 1; h.Len() > 0 && leaves < T.maxLeafNodes; leaves++ {
+		split := heap.Pop(h).(*splitCandidate)
+		node := split.node
+		node.setSplit(split)
+		left, right := node.partition(X, split.idx)
+		node.children = []DNode{T.leafNode(y, left), T.leafNode(y, right)}
+
+		for k, childIdx := range [][]int{left, right} {
+			child := &node.children[k]
+			if child.nSamples == 0 {
+				child.predictedClass = node.predictedClass
+				continue
+			}
+			if childSplit := T.findSplit(X, y, childIdx, split.depth+1, child); childSplit != nil {
+				childSplit.node = child
+				heap.Push(h, childSplit)
+			}
+		}
+	}
+	return root
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"proj3/concurrent"
+)
+
+// Settings of gradient boosting on top of the settings of the trees
+type BoostConfig struct {
+
+	// The loss minimized: "log" (logistic for two classes, softmax for more)
+	// or "squared" for labels that are numbers
+	loss string
+
+	// The most rounds of boosting, each adding one tree per output
+	rounds int
+
+	// The factor shrinking the output of every tree
+	learningRate float64
+
+	// The fraction of the training rows every round is fitted on
+	subsample float64
+
+	// Training stops after this many rounds without a better loss on the
+	// validation rows, the fraction validation of the training rows held out
+	// for it. There is no early stopping if earlyStopping is 0
+	earlyStopping int
+	validation    float64
+}
+
+// Gradient boosted trees. Every tree is a regression tree fitted on the
+// gradient of the loss and adds its output, shrunk by the learning rate, to
+// the raw score of one output
+type Boosting struct {
+
+	// "squared", "logistic" or "softmax"
+	loss         string
+	learningRate float64
+
+	// The raw score of every output before any tree
+	init []float64
+
+	// The output each tree of the forest adds to
+	outputs []int
+}
+
+// Function to find the number of outputs boosted for the loss
+func boostOutputs(loss string, classes int) int {
+	if loss == "softmax" {
+		return classes
+	}
+	return 1
+}
+
+// Function to find the probability of every class from the raw scores of a row
+func (B *Boosting) probabilities(raw []float64) []float64 {
+	if B.loss == "logistic" {
+		p := 1 / (1 + math.Exp(-raw[0]))
+		return []float64{1 - p, p}
+	}
+	maxRaw := math.Inf(-1)
+	for _, v := range raw {
+		maxRaw = math.Max(maxRaw, v)
+	}
+	p := make([]float64, len(raw))
+	total := 0.0
+	for k, v := range raw {
+		p[k] = math.Exp(v - maxRaw)
+		total += p[k]
+	}
+	for k := range p {
+		p[k] /= total
+	}
+	return p
+}
+
+// Function to find the prediction from the raw scores of a row: the value
+// for the squared loss and the most probable class otherwise
+func (B *Boosting) prediction(raw []float64) float64 {
+	switch B.loss {
+	case "squared":
+		return raw[0]
+	case "logistic":
+		if raw[0] > 0 {
+			return 1
+		}
+		return 0
+	}
+	best := 0
+	for k := range raw {
+		if raw[k] > raw[best] {
+			best = k
+		}
+	}
+	return float64(best)
+}
+
+// Function to find the loss of a row from its raw scores and its target,
+// the value for the squared loss and the class otherwise
+func (B *Boosting) rowLoss(raw []float64, target float64) float64 {
+	if B.loss == "squared" {
+		return (target - raw[0]) * (target - raw[0])
+	}
+	p := B.probabilities(raw)[int(target)]
+	return -math.Log(math.Max(p, 1e-15))
+}
+
+// Function to find the negative gradient of the loss of a row for output k
+func (B *Boosting) residual(raw []float64, target float64, k int) float64 {
+	switch B.loss {
+	case "squared":
+		return target - raw[0]
+	case "logistic":
+		return target - B.probabilities(raw)[1]
+	}
+	p := B.probabilities(raw)[k]
+	if int(target) == k {
+		return 1 - p
+	}
+	return -p
+}
+
+// Function to find the raw scores of the rows idx of the data
+func (F *Forest) rawScores(X Matrix, idx []int) [][]float64 {
+	B := F.boost
+	raw := make([][]float64, len(idx))
+	for j := range raw {
+		raw[j] = append([]float64(nil), B.init...)
+	}
+	for t, tree := range F.trees {
+		k := B.outputs[t]
+		for j, v := range tree.predict(X, idx) {
+			raw[j][k] += B.learningRate * v
+		}
+	}
+	return raw
+}
+
+// Creating a callable fitting the regression tree of one output in a round
+type BoostTask struct {
+	X         Matrix
+	residuals []float64
+	sample    []int
+	config    *ForestConfig
+	loss      string
+	outputs   int
+	seed      int64
+}
+
+// Defining the Call function for the Executor. For the log losses the
+// values of the nodes are then set to one Newton step of the loss. The
+// values are bounded by the monotonic constraints last
+func (task *BoostTask) Call() interface{} {
+	features := make([]int, task.X.Cols())
+	for j := range features {
+		features[j] = j
+	}
+	tree := task.config.newTree(features, task.seed)
+	tree.fit(task.X, task.residuals, task.sample)
+	if task.config.ccpAlpha > 0 {
+		tree.prune(task.config.ccpAlpha)
+	}
+	if task.loss == "squared" {
+		tree.boundValues()
+		return tree
+	}
+
+	// Every node on the way of a row to its leaf gets the row, so that the
+	// split nodes also hold the step of their rows for the bounds
+	num := make(map[*DNode]float64)
+	den := make(map[*DNode]float64)
+	w := tree.rowWeights(task.sample)
+	for k, i := range task.sample {
+		r := task.residuals[i]
+		node := &tree.root
+		for {
+			num[node] += w[k] * r
+			den[node] += w[k] * math.Abs(r) * (1 - math.Abs(r))
+			if node.nodeType == "leaf" || len(node.children) != 2 {
+				break
+			}
+			if node.goesLeft(task.X, i) {
+				node = &node.children[0]
+			} else {
+				node = &node.children[1]
+			}
+		}
+	}
+	scale := 1.0
+	if task.loss == "softmax" {
+		scale = float64(task.outputs-1) / float64(task.outputs)
+	}
+	for node := range num {
+		node.predictedClass = 0
+		if den[node] > 1e-150 {
+			node.predictedClass = scale * num[node] / den[node]
+		}
+	}
+	tree.boundValues()
+	return tree
+}
+
+// GradientBoost trains gradient boosted trees on the rows train of the data
+// with the settings of the trees in config. The trees of every output of a
+// round are fitted at the same time on the executor. The loss on the
+// validation rows after every round is returned with the forest, empty
+// without early stopping. The validation rows, the subsamples and the trees
+// are drawn from the seed
+func GradientBoost(executor concurrent.ExecutorService, X Matrix, y []float64, train []int, config *ForestConfig, boost *BoostConfig, columns []Column, label Column, seed int64) (*Forest, []float64, error) {
+	rng := rand.New(rand.NewSource(seed))
+	B := &Boosting{loss: boost.loss, learningRate: boost.learningRate}
+	switch {
+	case boost.loss == "squared":
+	case boost.loss == "log" && len(label.levels) < 2:
+		return nil, nil, fmt.Errorf("the log loss needs at least 2 classes")
+	case boost.loss == "log" && len(label.levels) == 2:
+		B.loss = "logistic"
+	case boost.loss == "log":
+		B.loss = "softmax"
+	default:
+		return nil, nil, fmt.Errorf("unknown loss %q", boost.loss)
+	}
+	if config.monotone != nil && B.loss == "softmax" {
+		return nil, nil, fmt.Errorf("monotonic constraints need the squared loss or two classes, not %d", len(label.levels))
+	}
+	K := boostOutputs(B.loss, len(label.levels))
+
+	// Holding out the validation rows for the early stopping
+	fitRows, validRows := train, []int(nil)
+	if boost.earlyStopping > 0 && boost.validation > 0 {
+		perm := rng.Perm(len(train))
+		nValid := int(math.Round(boost.validation * float64(len(train))))
+		if nValid < 1 || nValid >= len(train) {
+			return nil, nil, fmt.Errorf("a validation fraction of %g leaves no rows to fit or to validate", boost.validation)
+		}
+		validRows, fitRows = make([]int, nValid), make([]int, len(train)-nValid)
+		for k, p := range perm {
+			if k < nValid {
+				validRows[k] = train[p]
+			} else {
+				fitRows[k-nValid] = train[p]
+			}
+		}
+	}
+
+	// Starting from the weighted mean of the values or the log of the
+	// weighted share of the classes
+	grow := *config
+	grow.regression, grow.bootstrap, grow.classCounts = true, false, nil
+	grow.sqrtCols = X.Cols()
+	w := weightsOf(grow.weights, fitRows)
+	B.init = make([]float64, K)
+	if B.loss == "squared" {
+		B.init[0] = weightedMean(pick(y, fitRows), w)
+	} else {
+		share := make([]float64, len(label.levels))
+		total := sum(w)
+		for k, i := range fitRows {
+			share[int(y[i])] += w[k] / total
+		}
+		for c := range share {
+			share[c] = math.Min(math.Max(share[c], 1e-15), 1-1e-15)
+		}
+		if B.loss == "logistic" {
+			B.init[0] = math.Log(share[1] / share[0])
+		} else {
+			for c := range share {
+				B.init[c] = math.Log(share[c])
+			}
+		}
+	}
+
+	F := &Forest{columns: columns, label: label, config: &grow, boost: B}
+	raw := make([][]float64, X.Rows())
+	for _, rows := range [][]int{fitRows, validRows} {
+		for _, i := range rows {
+			raw[i] = append([]float64(nil), B.init...)
+		}
+	}
+
+	var validLoss []float64
+	best, bestRound := math.Inf(1), 0
+	nSample := int(math.Round(boost.subsample * float64(len(fitRows))))
+	if nSample < 1 || nSample > len(fitRows) {
+		nSample = len(fitRows)
+	}
+	for round := 0; round < boost.rounds; round++ {
+		sample := fitRows
+		if nSample < len(fitRows) {
+			sample = make([]int, nSample)
+			for k, p := range rng.Perm(len(fitRows))[:nSample] {
+				sample[k] = fitRows[p]
+			}
+		}
+
+		// Fitting one tree per output on the negative gradients
+		var tasks []concurrent.Callable
+		for k := 0; k < K; k++ {
+			residuals := make([]float64, X.Rows())
+			for _, i := range sample {
+				residuals[i] = B.residual(raw[i], y[i], k)
+			}
+			tasks = append(tasks, &BoostTask{X: X, residuals: residuals, sample: sample, config: &grow, loss: B.loss, outputs: K, seed: treeSeed(seed, len(F.trees)+k)})
+		}
+		for k, result := range runTasks(executor, tasks) {
+			tree := result.(*Tree)
+			F.trees = append(F.trees, tree)
+			B.outputs = append(B.outputs, k)
+			for _, rows := range [][]int{fitRows, validRows} {
+				for j, v := range tree.predict(X, rows) {
+					raw[rows[j]][k] += B.learningRate * v
+				}
+			}
+		}
+
+		if validRows == nil {
+			continue
+		}
+		loss := 0.0
+		for _, i := range validRows {
+			loss += B.rowLoss(raw[i], y[i]) / float64(len(validRows))
+		}
+		validLoss = append(validLoss, loss)
+		if loss < best {
+			best, bestRound = loss, round+1
+		} else if round+1-bestRound >= boost.earlyStopping {
+			break
+		}
+	}
+
+	// Keeping the rounds up to the best loss on the validation rows
+	if validRows != nil {
+		F.trees, B.outputs = F.trees[:bestRound*K], B.outputs[:bestRound*K]
+	}
+	return F, validLoss, nil
+}
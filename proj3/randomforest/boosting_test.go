@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Function to make a numeric label from the data of testData, a function of
+// the numeric columns, with the column of the label
+func testRegressionLabel(X Matrix) ([]float64, Column) {
+	y := make([]float64, X.Rows())
+	for i := range y {
+		y[i] = 4*X.At(i, 0) + math.Sin(X.At(i, 1)) + 0.3*X.At(i, 2)
+	}
+	return y, Column{name: "target"}
+}
+
+// Function to make a label of two classes from the classes of testData, 1
+// for the rows of class 2 and 0 for the others
+func testBinaryLabel(y []float64) ([]float64, Column) {
+	yBinary := make([]float64, len(y))
+	for i := range y {
+		if y[i] == 2 {
+			yBinary[i] = 1
+		}
+	}
+	return yBinary, newLabelColumn("positive", []string{"0", "1"})
+}
+
+// Function to boost 10 rounds of trees 3 deep on all the rows of the data
+// with the loss and the monotonic constraints, from the seed
+func testBoost(t *testing.T, X Matrix, y []float64, columns []Column, label Column, loss string, monotone []int, seed int64) *Forest {
+	t.Helper()
+	config := &ForestConfig{maxDepth: 3, sqrtCols: X.Cols(), monotone: monotone}
+	for j := range columns {
+		config.categorical = append(config.categorical, columns[j].categorical)
+	}
+	boost := &BoostConfig{loss: loss, rounds: 10, learningRate: 0.3, subsample: 0.8}
+	F, _, err := GradientBoost(nil, X, y, allRows(X.Rows()), config, boost, columns, label, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	F.seed, F.rows = seed, X.Rows()
+	return F
+}
+
+func TestBoostSaveLoad(t *testing.T) {
+	X, y, columns := testData(200, 3)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+	yReg, target := testRegressionLabel(X)
+	yBinary, binary := testBinaryLabel(y)
+	rows := allRows(X.Rows())
+
+	tests := []struct {
+		name  string
+		y     []float64
+		label Column
+		loss  string
+	}{
+		{name: "softmax", y: y, label: classes, loss: "log"},
+		{name: "logistic", y: yBinary, label: binary, loss: "log"},
+		{name: "squared", y: yReg, label: target, loss: "squared"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			F := testBoost(t, X, test.y, columns, test.label, test.loss, nil, 5)
+			if again := testBoost(t, X, test.y, columns, test.label, test.loss, nil, 5); !reflect.DeepEqual(again.predictions(X, rows), F.predictions(X, rows)) {
+				t.Error("boosting twice from the same seed gives different predictions")
+			}
+			loaded := saveLoad(t, F)
+			if got, want := loaded.predictions(X, rows), F.predictions(X, rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("the loaded forest predicts %v, want %v", got[:5], want[:5])
+			}
+			if got, want := loaded.rawScores(X, rows), F.rawScores(X, rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("the loaded forest gives the raw scores %v, want %v", got[:2], want[:2])
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Calibration of the class probabilities of a forest, fitted one class
+// against the rest. With two classes only the second class is calibrated
+// and the first gets the rest of the probability, otherwise the calibrated
+// probabilities of the classes are scaled to sum to 1
+type Calibration struct {
+
+	// "platt" or "isotonic"
+	method string
+
+	// The calibrator of every class calibrated
+	classes []calibrator
+}
+
+// Calibrator of the probability of one class: the sigmoid 1 / (1 + exp(a p
+// + b)) of Platt scaling, or the steps of isotonic regression, the
+// calibrated value y[k] at x[k], interpolated in between
+type calibrator struct {
+	a, b float64
+	x, y []float64
+}
+
+// Function to find the calibrated probability of a class
+func (c *calibrator) apply(method string, p float64) float64 {
+	if method == "platt" {
+		return 1 / (1 + math.Exp(c.a*p+c.b))
+	}
+	if len(c.x) == 0 {
+		return p
+	}
+	k := sort.SearchFloat64s(c.x, p)
+	switch {
+	case k == 0:
+		return c.y[0]
+	case k == len(c.x):
+		return c.y[len(c.y)-1]
+	case c.x[k] == p:
+		return c.y[k]
+	}
+	t := (p - c.x[k-1]) / (c.x[k] - c.x[k-1])
+	return c.y[k-1] + t*(c.y[k]-c.y[k-1])
+}
+
+// Function to fit Platt scaling on the probabilities p and whether each row
+// is of the class, by Newton's method on the log loss with the targets
+// smoothed as Platt proposed so that the sigmoid does not overfit
+func fitPlatt(p []float64, positive []bool) calibrator {
+	nPos, nNeg := 0.0, 0.0
+	for _, pos := range positive {
+		if pos {
+			nPos++
+		} else {
+			nNeg++
+		}
+	}
+	t := make([]float64, len(p))
+	for k, pos := range positive {
+		t[k] = 1 / (nNeg + 2)
+		if pos {
+			t[k] = (nPos + 1) / (nPos + 2)
+		}
+	}
+
+	// The loss of a and b, written so that the exponent never overflows
+	loss := func(a, b float64) float64 {
+		total := 0.0
+		for k := range p {
+			f := a*p[k] + b
+			if f >= 0 {
+				total += t[k]*f + math.Log1p(math.Exp(-f))
+			} else {
+				total += (t[k]-1)*f + math.Log1p(math.Exp(f))
+			}
+		}
+		return total
+	}
+
+	a, b := 0.0, math.Log((nNeg+1)/(nPos+1))
+	current := loss(a, b)
+	for iter := 0; iter < 100; iter++ {
+		// The gradient and the Hessian of the loss, kept positive definite
+		g1, g2, h11, h22, h21 := 0.0, 0.0, 1e-12, 1e-12, 0.0
+		for k := range p {
+			q := 1 / (1 + math.Exp(a*p[k]+b))
+			d1 := t[k] - q
+			d2 := q * (1 - q)
+			g1 += p[k] * d1
+			g2 += d1
+			h11 += p[k] * p[k] * d2
+			h22 += d2
+			h21 += p[k] * d2
+		}
+		if math.Abs(g1) < 1e-5 && math.Abs(g2) < 1e-5 {
+			break
+		}
+		det := h11*h22 - h21*h21
+		da := -(h22*g1 - h21*g2) / det
+		db := -(-h21*g1 + h11*g2) / det
+
+		// Halving the step until the loss goes down
+		step := 1.0
+		for step >= 1e-10 {
+			next := loss(a+step*da, b+step*db)
+			if next < current+1e-4*step*(g1*da+g2*db) {
+				a, b, current = a+step*da, b+step*db, next
+				break
+			}
+			step /= 2
+		}
+		if step < 1e-10 {
+			break
+		}
+	}
+	return calibrator{a: a, b: b}
+}
+
+// Function to fit isotonic regression on the probabilities p and whether
+// each row is of the class with the pool adjacent violators algorithm: the
+// non-decreasing steps closest to the share of the rows of the class
+func fitIsotonic(p []float64, positive []bool) calibrator {
+	order := make([]int, len(p))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool { return p[order[a]] < p[order[b]] })
+
+	// Every block holds the mean of x and y of its rows and their number
+	type block struct{ x, y, n float64 }
+	var blocks []block
+	for _, k := range order {
+		y := 0.0
+		if positive[k] {
+			y = 1
+		}
+		if len(blocks) > 0 && blocks[len(blocks)-1].x == p[k] {
+			last := &blocks[len(blocks)-1]
+			last.y = (last.y*last.n + y) / (last.n + 1)
+			last.n++
+		} else {
+			blocks = append(blocks, block{x: p[k], y: y, n: 1})
+		}
+		for len(blocks) > 1 && blocks[len(blocks)-2].y >= blocks[len(blocks)-1].y {
+			a, b := blocks[len(blocks)-2], blocks[len(blocks)-1]
+			n := a.n + b.n
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{x: (a.x*a.n + b.x*b.n) / n, y: (a.y*a.n + b.y*b.n) / n, n: n})
+		}
+	}
+
+	var c calibrator
+	for _, bl := range blocks {
+		c.x, c.y = append(c.x, bl.x), append(c.y, bl.y)
+	}
+	return c
+}
+
+// FitCalibration fits the calibration of the class probabilities with the
+// method, platt or isotonic, on the uncalibrated probabilities of some rows
+// and their classes y
+func FitCalibration(method string, probs [][]float64, y []float64, classes int) (*Calibration, error) {
+	if method != "platt" && method != "isotonic" {
+		return nil, fmt.Errorf("unknown calibration %q, expected platt or isotonic", method)
+	}
+	if len(probs) == 0 {
+		return nil, fmt.Errorf("no rows to fit the calibration on")
+	}
+	C := &Calibration{method: method}
+	first := 0
+	if classes == 2 {
+		first = 1
+	}
+	for c := first; c < classes; c++ {
+		p := make([]float64, len(probs))
+		positive := make([]bool, len(probs))
+		for k := range probs {
+			p[k], positive[k] = probs[k][c], int(y[k]) == c
+		}
+		if method == "platt" {
+			C.classes = append(C.classes, fitPlatt(p, positive))
+		} else {
+			C.classes = append(C.classes, fitIsotonic(p, positive))
+		}
+	}
+	return C, nil
+}
+
+// Function to calibrate the probabilities of every class of the rows
+func (C *Calibration) apply(probs [][]float64) [][]float64 {
+	calibrated := make([][]float64, len(probs))
+	for k, row := range probs {
+		out := make([]float64, len(row))
+		if len(row) == 2 && len(C.classes) == 1 {
+			out[1] = C.classes[0].apply(C.method, row[1])
+			out[0] = 1 - out[1]
+		} else {
+			total := 0.0
+			for c := range row {
+				if c < len(C.classes) {
+					out[c] = C.classes[c].apply(C.method, row[c])
+				}
+				total += out[c]
+			}
+			for c := range out {
+				if total > 0 {
+					out[c] /= total
+				} else {
+					out[c] = 1 / float64(len(out))
+				}
+			}
+		}
+		calibrated[k] = out
+	}
+	return calibrated
+}
+
+// Function to find the probability of every class for the rows idx of the
+// data before any calibration: the share of the votes of the trees, or the
+// probabilities of boosted trees
+func (F *Forest) voteFractions(X Matrix, idx []int) [][]float64 {
+	classes := len(F.label.levels)
+	probs := make([][]float64, len(idx))
+	if F.boost != nil {
+		for j, raw := range F.rawScores(X, idx) {
+			probs[j] = F.boost.probabilities(raw)
+		}
+		return probs
+	}
+	for j := range probs {
+		probs[j] = make([]float64, classes)
+	}
+	counts := make([]float64, len(idx))
+	for _, tree := range F.trees {
+		for j, pred := range tree.predict(X, idx) {
+			if pred >= 0 && int(pred) < classes {
+				probs[j][int(pred)]++
+				counts[j]++
+			}
+		}
+	}
+	for j := range probs {
+		for c := range probs[j] {
+			if counts[j] > 0 {
+				probs[j][c] /= counts[j]
+			}
+		}
+	}
+	return probs
+}
+
+// Function to find the share of the votes of every class for the training
+// rows from the trees that did not see them, with the rows that have at
+// least one such tree
+func (F *Forest) oobFractions(X Matrix) ([]int, [][]float64) {
+	classes := len(F.label.levels)
+	votes := make(map[int][]float64)
+	for _, tree := range F.trees {
+		for k, pred := range tree.predict(X, tree.oob) {
+			i := tree.oob[k]
+			if votes[i] == nil {
+				votes[i] = make([]float64, classes)
+			}
+			if pred >= 0 && int(pred) < classes {
+				votes[i][int(pred)]++
+			}
+		}
+	}
+	var rows []int
+	for i := range votes {
+		rows = append(rows, i)
+	}
+	sort.Ints(rows)
+	probs := make([][]float64, len(rows))
+	for k, i := range rows {
+		total := sum(votes[i])
+		probs[k] = votes[i]
+		for c := range probs[k] {
+			if total > 0 {
+				probs[k][c] /= total
+			}
+		}
+	}
+	return rows, probs
+}
+
+// Function to find the probabilities of every class for the rows idx of the
+// data, calibrated if the forest has a calibration
+func (F *Forest) probabilities(X Matrix, idx []int) [][]float64 {
+	probs := F.voteFractions(X, idx)
+	if F.calibration != nil {
+		return F.calibration.apply(probs)
+	}
+	return probs
+}
+
+// Function to find the Brier score of the probabilities: the squared
+// difference between the probability of every class and 1 for the class of
+// the row or 0 for the others, summed over the classes and averaged over the
+// rows
+func BrierScore(probs [][]float64, y []float64) float64 {
+	if len(probs) == 0 {
+		return 0
+	}
+	total := 0.0
+	for k, row := range probs {
+		for c, p := range row {
+			target := 0.0
+			if int(y[k]) == c {
+				target = 1
+			}
+			total += (p - target) * (p - target)
+		}
+	}
+	return total / float64(len(probs))
+}
+
+// Function to write the reliability diagram of the probabilities before and
+// after calibration to a csv: for every class, or only the second one with
+// two classes, the rows are put in bins of equal width by their probability
+// of the class, and each bin gets its mean probability and the share of its
+// rows that are of the class
+func WriteReliability(path string, before [][]float64, after [][]float64, y []float64, label Column, bins int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"stage", "class", "bin_low", "bin_high", "rows", "mean_predicted", "observed"})
+	classes := len(label.levels)
+	first := 0
+	if classes == 2 {
+		first = 1
+	}
+	for _, stage := range []struct {
+		name  string
+		probs [][]float64
+	}{{"before", before}, {"after", after}} {
+		for c := first; c < classes; c++ {
+			n := make([]float64, bins)
+			predicted := make([]float64, bins)
+			observed := make([]float64, bins)
+			for k, row := range stage.probs {
+				b := int(row[c] * float64(bins))
+				if b >= bins {
+					b = bins - 1
+				}
+				n[b]++
+				predicted[b] += row[c]
+				if int(y[k]) == c {
+					observed[b]++
+				}
+			}
+			for b := 0; b < bins; b++ {
+				if n[b] == 0 {
+					continue
+				}
+				w.Write([]string{
+					stage.name,
+					label.level(float64(c)),
+					strconv.FormatFloat(float64(b)/float64(bins), 'g', 4, 64),
+					strconv.FormatFloat(float64(b+1)/float64(bins), 'g', 4, 64),
+					strconv.Itoa(int(n[b])),
+					strconv.FormatFloat(predicted[b]/n[b], 'g', 6, 64),
+					strconv.FormatFloat(observed[b]/n[b], 'g', 6, 64),
+				})
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
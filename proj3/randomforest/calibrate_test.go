@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFitIsotonic(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        []float64
+		positive []bool
+		x, y     []float64
+	}{
+		{name: "in order", p: []float64{0.125, 0.5, 0.75}, positive: []bool{false, true, true}, x: []float64{0.125, 0.625}, y: []float64{0, 1}},
+		{name: "pooled", p: []float64{0.25, 0.5, 0.75, 1}, positive: []bool{false, true, false, true}, x: []float64{0.25, 0.625, 1}, y: []float64{0, 0.5, 1}},
+		{name: "ties", p: []float64{0.5, 0.5, 0.875}, positive: []bool{true, false, true}, x: []float64{0.5, 0.875}, y: []float64{0.5, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := fitIsotonic(test.p, test.positive)
+			if !reflect.DeepEqual(c.x, test.x) || !reflect.DeepEqual(c.y, test.y) {
+				t.Errorf("got the steps %v -> %v, want %v -> %v", c.x, c.y, test.x, test.y)
+			}
+		})
+	}
+}
+
+func TestCalibratedSaveLoad(t *testing.T) {
+	X, y, columns := testData(200, 3)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+	rows := allRows(X.Rows())
+
+	for _, method := range []string{"platt", "isotonic"} {
+		t.Run(method, func(t *testing.T) {
+			F := testForest(X, y, columns, classes, &ForestConfig{maxDepth: 8, bootstrap: true, sqrtCols: 2}, 10, 5)
+			calibration, err := FitCalibration(method, F.voteFractions(X, rows), y, len(classes.levels))
+			if err != nil {
+				t.Fatal(err)
+			}
+			F.calibration = calibration
+			want := F.probabilities(X, rows)
+			for k, probs := range want {
+				if math.Abs(sum(probs)-1) > 1e-9 {
+					t.Fatalf("row %d: the calibrated probabilities %v do not sum to 1", k, probs)
+				}
+			}
+			if got := saveLoad(t, F).probabilities(X, rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("the loaded forest gives the probabilities %v, want %v", got[:2], want[:2])
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column stores how a feature column of the dataset is interpreted
+type Column struct {
+	name string
+
+	// If the column holds categories instead of numbers
+	categorical bool
+
+	// The category strings, indexed by the code stored in the data
+	levels []string
+	codes  map[string]int
+}
+
+// Function to check if a cell of the csv is missing
+func isMissing(str string) bool {
+	str = strings.TrimSpace(str)
+	return str == "" || str == "?"
+}
+
+// Function to check if a value of the csv is a number
+func isNumeric(str string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	return err == nil
+}
+
+// Function to get the code of a category, adding it to the column if it is new
+func (c *Column) encode(str string) float64 {
+	str = strings.TrimSpace(str)
+	code, ok := c.codes[str]
+	if !ok {
+		code = len(c.levels)
+		c.codes[str] = code
+		c.levels = append(c.levels, str)
+	}
+	return float64(code)
+}
+
+// Function to get the category string for a code
+func (c *Column) level(code float64) string {
+	k := int(code)
+	if k < 0 || k >= len(c.levels) {
+		return strconv.FormatFloat(code, 'g', -1, 64)
+	}
+	return c.levels[k]
+}
+
+// Function to calculate the entropy from the class counts of a set of rows.
+// The classes are added up in order, so that the same counts always give
+// the same entropy and the ties between splits are broken the same way
+func entropyCounts(counts map[float64]float64, n float64) float64 {
+	if n <= 0 {
+		return 0
+	}
+	classes := make([]float64, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Float64s(classes)
+	sum := 0.0
+	for _, class := range classes {
+		if value := counts[class]; value > 0 {
+			p := value / n
+			sum -= math.Log2(p) * p
+		}
+	}
+	return sum
+}
+
+// Function to sort the categories by a score of each, the smaller category
+// first on ties. The best split of the categories into two sets is then
+// between two of the sorted categories
+func sortCategories(cats []float64, score func(cat float64) float64) {
+	sort.Slice(cats, func(a, b int) bool {
+		scoreA, scoreB := score(cats[a]), score(cats[b])
+		if scoreA == scoreB || math.IsNaN(scoreA) || math.IsNaN(scoreB) {
+			return cats[a] < cats[b]
+		}
+		return scoreA < scoreB
+	})
+}
+
+// Helper function to importance for categorical columns. The categories are
+// sorted by the rate of the most frequent class in the node and the best
+// split between the sorted categories is returned as the set of categories
+// going to the left child
+func (T *Tree) importanceCat(X []float64, y []float64, w []float64) (float64, map[float64]bool) {
+
+	// Weighing the classes and counting the rows in each category
+	catCounts := make(map[float64]map[float64]float64)
+	catTotal := make(map[float64]float64)
+	catRows := make(map[float64]int)
+	for i, cat := range X {
+		if _, ok := catCounts[cat]; !ok {
+			catCounts[cat] = make(map[float64]float64)
+		}
+		catCounts[cat][y[i]] += w[i]
+		catTotal[cat] += w[i]
+		catRows[cat]++
+	}
+	if len(catCounts) < 2 {
+		return math.Inf(2), nil
+	}
+
+	// Sorting the categories by the rate of the target class
+	target := weightedMostFrequent(y, w)
+	var cats []float64
+	for cat := range catCounts {
+		cats = append(cats, cat)
+	}
+	sortCategories(cats, func(cat float64) float64 { return catCounts[cat][target] / catTotal[cat] })
+
+	n := sum(w)
+	left := make(map[float64]float64)
+	right := weightedFreq(y, w)
+	nLeft := 0.0
+	rowsLeft := 0
+
+	minEntropy := math.Inf(2)
+	best := 0
+
+	for k := 0; k < len(cats)-1; k++ {
+
+		// Moving one category from the right to the left child
+		for class, cnt := range catCounts[cats[k]] {
+			left[class] += cnt
+			right[class] -= cnt
+		}
+		nLeft += catTotal[cats[k]]
+		rowsLeft += catRows[cats[k]]
+		if rowsLeft < T.minSamplesLeaf || len(y)-rowsLeft < T.minSamplesLeaf || n <= 0 {
+			continue
+		}
+
+		thisEntropy := nLeft/n*entropyCounts(left, nLeft) + (n-nLeft)/n*entropyCounts(right, n-nLeft)
+		if thisEntropy < minEntropy {
+			minEntropy = thisEntropy
+			best = k
+		}
+	}
+
+	if math.IsInf(minEntropy, 1) {
+		return minEntropy, nil
+	}
+	leftSet := make(map[float64]bool)
+	for k := 0; k <= best; k++ {
+		leftSet[cats[k]] = true
+	}
+	return minEntropy, leftSet
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Options to describe how a dataset file is read
+type LoadOptions struct {
+
+	// If the first row of the file holds the column names
+	Header bool
+
+	// The character separating the values, a comma by default
+	Delimiter rune
+
+	// The column of the y variable by name or index, the last column if empty
+	Label string
+
+	// The file has no y variable: every column can be a feature, the y
+	// variable is 0 for every row and the label has no classes
+	Unlabeled bool
+
+	// The feature columns to keep or to leave out, by name or index
+	Select []string
+	Drop   []string
+
+	// The columns to treat as categorical, by name or index
+	Categorical []string
+
+	// The column holding the weight of each row by name or index, none if
+	// empty. The column is not used as a feature
+	Weight string
+
+	// The columns of the y variables predicted along with the label by a
+	// multi-output forest, by name or index. They are not used as features
+	Outputs []string
+
+	// The label and the outputs are numbers to predict, read as values
+	// instead of classes
+	NumericLabel bool
+
+	// Store the feature values as float32 instead of float64
+	Float32 bool
+
+	// Called while the file is read with the pass over the file (1 while
+	// scanning it, 2 while loading it), the rows and bytes read so far and
+	// the size of the file
+	Progress func(pass int, rows int, read int64, size int64)
+}
+
+// Dataset read from a file. The y variable is encoded as class indices, or
+// holds its values if it is numeric, and the weights of the rows are nil
+// unless a weight column was read
+type Dataset struct {
+	X       Matrix
+	y       []float64
+	weights []float64
+	columns []Column
+	label   Column
+
+	// The other y variables of a multi-output dataset, encoded like y, with
+	// the column of each
+	outputs []Column
+	outputY [][]float64
+
+	// The rows of every feature column whose value is missing in the file,
+	// and the column of the file every feature column was read from
+	missing [][]int
+	sources []int
+}
+
+// Number of rows between two calls of the progress function
+const progressEvery = 100000
+
+// Error with the position of the value of the file that could not be read.
+// Rows and columns are counted from 1 as in a text editor
+type ParseError struct {
+	Row   int
+	Col   int
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("row %d, column %d (%s): %q: %v", e.Row, e.Col, e.Name, e.Value, e.Err)
+	}
+	return fmt.Sprintf("row %d, column %d: %v", e.Row, e.Col, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var errMissingLabel = errors.New("missing value of the y variable")
+
+var errNumericLabel = errors.New("expected a y variable that is a number")
+
+var errBadWeight = errors.New("expected a weight that is a number of at least 0")
+
+// Function to parse the name of a delimiter given on the command line
+func ParseDelimiter(str string) (rune, error) {
+	switch str {
+	case "", ",", "comma":
+		return ',', nil
+	case "\\t", "\t", "tab", "tsv":
+		return '\t', nil
+	case ";", "semicolon":
+		return ';', nil
+	}
+	r := []rune(str)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("invalid delimiter %q", str)
+	}
+	return r[0], nil
+}
+
+// Function to split a comma separated list of column names or indices
+func SplitList(str string) []string {
+	var lst []string
+	for _, part := range strings.Split(str, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			lst = append(lst, part)
+		}
+	}
+	return lst
+}
+
+// Function to find a column by its name or, failing that, by its index
+func resolveColumn(spec string, names []string) (int, error) {
+	for j, name := range names {
+		if name == spec {
+			return j, nil
+		}
+	}
+	k, err := strconv.Atoi(spec)
+	if err != nil || k < 0 || k >= len(names) {
+		return 0, fmt.Errorf("unknown column %q", spec)
+	}
+	return k, nil
+}
+
+// Function to find a set of columns by their names or indices
+func resolveColumns(specs []string, names []string) (map[int]bool, error) {
+	m := make(map[int]bool)
+	for _, spec := range specs {
+		k, err := resolveColumn(spec, names)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = true
+	}
+	return m, nil
+}
+
+// Reader counting the bytes read from the file, to report the progress
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Function to start reading the records of the file from its beginning
+func openRecords(f *os.File, delimiter rune) (*csv.Reader, *countingReader, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	counter := &countingReader{r: f}
+	csvReader := csv.NewReader(bufio.NewReaderSize(counter, 1<<20))
+	if delimiter != 0 {
+		csvReader.Comma = delimiter
+	}
+	csvReader.ReuseRecord = true
+	return csvReader, counter, nil
+}
+
+// Function to read the next record, with the position of any problem
+func nextRecord(csvReader *csv.Reader) ([]string, error) {
+	record, err := csvReader.Read()
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return nil, &ParseError{Row: csvErr.Line, Col: csvErr.Column, Err: csvErr.Err}
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// LoadDataset reads the file at path as described by opts. The file is
+// streamed twice: once to find the size of the data, the categorical columns
+// and the classes, and once to parse the values straight into a matrix of
+// the right size. Categorical columns are encoded as the index of their
+// category in the matching Column and the missing values of numeric columns
+// are replaced by 0
+func LoadDataset(path string, opts LoadOptions) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	csvReader, counter, err := openRecords(f, opts.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	first, err := nextRecord(csvReader)
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: no data", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Naming the columns from the header or from their position
+	fileCols := len(first)
+	names := make([]string, fileCols)
+	firstRow := 1
+	for j := range names {
+		names[j] = fmt.Sprintf("col%d", j)
+	}
+	if opts.Header {
+		for j, name := range first {
+			if name = strings.TrimSpace(name); name != "" {
+				names[j] = name
+			}
+		}
+		firstRow = 2
+	}
+
+	labelCol := fileCols - 1
+	if opts.Unlabeled {
+		if opts.Label != "" {
+			return nil, fmt.Errorf("%s: a label column is given for unlabeled data", path)
+		}
+		labelCol = -1
+	} else if opts.Label != "" {
+		if labelCol, err = resolveColumn(opts.Label, names); err != nil {
+			return nil, err
+		}
+	}
+	selected, err := resolveColumns(opts.Select, names)
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := resolveColumns(opts.Drop, names)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := resolveColumns(opts.Categorical, names)
+	if err != nil {
+		return nil, err
+	}
+	weightCol := -1
+	if opts.Weight != "" {
+		if weightCol, err = resolveColumn(opts.Weight, names); err != nil {
+			return nil, err
+		}
+		if weightCol == labelCol {
+			return nil, fmt.Errorf("%s: the weight column is the label column", path)
+		}
+	}
+	var outputCols []int
+	for _, spec := range opts.Outputs {
+		k, err := resolveColumn(spec, names)
+		if err != nil {
+			return nil, err
+		}
+		if labelCol < 0 || k == labelCol || k == weightCol {
+			return nil, fmt.Errorf("%s: the output column %q is the label or weight column, or the data is unlabeled", path, spec)
+		}
+		outputCols = append(outputCols, k)
+	}
+	isOutput := make(map[int]bool)
+	for _, k := range outputCols {
+		isOutput[k] = true
+	}
+
+	// The features keep their order in the file
+	var features []int
+	for j := 0; j < fileCols; j++ {
+		if j == labelCol || j == weightCol || isOutput[j] || dropped[j] || (len(selected) > 0 && !selected[j]) {
+			continue
+		}
+		features = append(features, j)
+	}
+	if len(features) == 0 {
+		return nil, fmt.Errorf("%s: no feature columns left", path)
+	}
+
+	// First pass: counting the rows, finding the columns that are not
+	// numbers and collecting the classes
+	categorical := make([]bool, fileCols)
+	for j := range declared {
+		categorical[j] = true
+	}
+	labelSeen := make(map[string]bool)
+	var labels []string
+	outputLabels := make([][]string, len(outputCols))
+	outputSeen := make([]map[string]bool, len(outputCols))
+	for o := range outputSeen {
+		outputSeen[o] = make(map[string]bool)
+	}
+	rows := 0
+	record := first
+	if opts.Header {
+		record, err = nextRecord(csvReader)
+	}
+	for ; err == nil; record, err = nextRecord(csvReader) {
+		if labelCol >= 0 {
+			if isMissing(record[labelCol]) {
+				return nil, &ParseError{Row: rows + firstRow, Col: labelCol + 1, Name: names[labelCol], Value: record[labelCol], Err: errMissingLabel}
+			}
+			if opts.NumericLabel && !isNumeric(record[labelCol]) {
+				return nil, &ParseError{Row: rows + firstRow, Col: labelCol + 1, Name: names[labelCol], Value: record[labelCol], Err: errNumericLabel}
+			}
+			if value := strings.TrimSpace(record[labelCol]); !labelSeen[value] {
+				labelSeen[value] = true
+				labels = append(labels, value)
+			}
+		}
+		for o, j := range outputCols {
+			if isMissing(record[j]) {
+				return nil, &ParseError{Row: rows + firstRow, Col: j + 1, Name: names[j], Value: record[j], Err: errMissingLabel}
+			}
+			if opts.NumericLabel && !isNumeric(record[j]) {
+				return nil, &ParseError{Row: rows + firstRow, Col: j + 1, Name: names[j], Value: record[j], Err: errNumericLabel}
+			}
+			if value := strings.TrimSpace(record[j]); !outputSeen[o][value] {
+				outputSeen[o][value] = true
+				outputLabels[o] = append(outputLabels[o], value)
+			}
+		}
+		for _, j := range features {
+			if !categorical[j] && !isMissing(record[j]) && !isNumeric(record[j]) {
+				categorical[j] = true
+			}
+		}
+		rows++
+		if opts.Progress != nil && rows%progressEvery == 0 {
+			opts.Progress(1, rows, counter.n, size)
+		}
+	}
+	if err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("%s: no data", path)
+	}
+	if opts.Progress != nil {
+		opts.Progress(1, rows, size, size)
+	}
+
+	ds := &Dataset{
+		X:       NewColMatrix(rows, len(features), opts.Float32),
+		y:       make([]float64, rows),
+		columns: make([]Column, len(features)),
+		missing: make([][]int, len(features)),
+		sources: features,
+	}
+	if labelCol >= 0 && opts.NumericLabel {
+		ds.label = Column{name: names[labelCol]}
+	} else if labelCol >= 0 {
+		ds.label = newLabelColumn(names[labelCol], labels)
+	} else {
+		ds.label = newLabelColumn("", nil)
+	}
+	if weightCol >= 0 {
+		ds.weights = make([]float64, rows)
+	}
+	for o, j := range outputCols {
+		if opts.NumericLabel {
+			ds.outputs = append(ds.outputs, Column{name: names[j]})
+		} else {
+			ds.outputs = append(ds.outputs, newLabelColumn(names[j], outputLabels[o]))
+		}
+		ds.outputY = append(ds.outputY, make([]float64, rows))
+	}
+	for k, j := range features {
+		ds.columns[k] = Column{name: names[j]}
+		if categorical[j] {
+			ds.columns[k].categorical = true
+			ds.columns[k].codes = make(map[string]int)
+		}
+	}
+
+	// Second pass: parsing the values into the matrix
+	csvReader, counter, err = openRecords(f, opts.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Header {
+		if _, err = nextRecord(csvReader); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	X := ds.X.(*ColMatrix)
+	for i := 0; i < rows; i++ {
+		record, err := nextRecord(csvReader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for k, j := range features {
+			if isMissing(record[j]) {
+				ds.missing[k] = append(ds.missing[k], i)
+			}
+			if ds.columns[k].categorical {
+				X.Set(i, k, ds.columns[k].encode(record[j]))
+				continue
+			}
+
+			// Putting 0 wherever the data is missing
+			thisFloat, error1 := strconv.ParseFloat(strings.TrimSpace(record[j]), 64)
+			if error1 != nil {
+				thisFloat = 0
+			}
+			X.Set(i, k, thisFloat)
+		}
+		if labelCol >= 0 {
+			ds.y[i] = labelValue(&ds.label, record[labelCol], opts.NumericLabel)
+		}
+		for o, j := range outputCols {
+			ds.outputY[o][i] = labelValue(&ds.outputs[o], record[j], opts.NumericLabel)
+		}
+		if weightCol >= 0 {
+			w, err := strconv.ParseFloat(strings.TrimSpace(record[weightCol]), 64)
+			if err != nil || !(w >= 0) || math.IsInf(w, 1) {
+				return nil, &ParseError{Row: i + firstRow, Col: weightCol + 1, Name: names[weightCol], Value: record[weightCol], Err: errBadWeight}
+			}
+			ds.weights[i] = w
+		}
+		if opts.Progress != nil && (i+1)%progressEvery == 0 {
+			opts.Progress(2, i+1, counter.n, size)
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(2, rows, size, size)
+	}
+	return ds, nil
+}
+
+// Function to get the y value of a cell of the file: the number itself if
+// the y variable is numeric, or the index of its class in the label column
+func labelValue(label *Column, str string, numeric bool) float64 {
+	if numeric {
+		v, _ := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		return v
+	}
+	return float64(label.codes[strings.TrimSpace(str)])
+}
+
+// ReadDataset reads the file at path in the given format, csv or libsvm.
+// Without a format, files with a LIBSVM extension are read as libsvm
+func ReadDataset(path string, format string, opts LoadOptions) (*Dataset, error) {
+	switch format {
+	case "libsvm", "svmlight":
+		return LoadLibSVM(path, opts)
+	case "":
+		if IsLibSVM(path) {
+			return LoadLibSVM(path, opts)
+		}
+		return LoadDataset(path, opts)
+	case "csv":
+		return LoadDataset(path, opts)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// Function to print the progress of reading a dataset to the standard error
+func PrintProgress(pass int, rows int, read int64, size int64) {
+	stage := "scanning"
+	if pass == 2 {
+		stage = "loading"
+	}
+	percent := 100.0
+	if size > 0 {
+		percent = 100 * float64(read) / float64(size)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d rows, %.1f%% of the file\n", stage, rows, percent)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Function to write the text to a csv in a temporary directory
+func writeCSV(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDatasetParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		opts LoadOptions
+		row  int
+		col  int
+		err  error
+	}{
+		{
+			name: "missing label",
+			text: "1,2,a\n3,4,?\n",
+			row:  2,
+			col:  3,
+			err:  errMissingLabel,
+		},
+		{
+			name: "missing label after header",
+			text: "x,y,class\n1,2,a\n3,4,b\n5,6,\n",
+			opts: LoadOptions{Header: true},
+			row:  4,
+			col:  3,
+			err:  errMissingLabel,
+		},
+		{
+			name: "missing output",
+			text: "x,out,class\n1,u,a\n2,,b\n",
+			opts: LoadOptions{Header: true, Outputs: []string{"out"}},
+			row:  3,
+			col:  2,
+			err:  errMissingLabel,
+		},
+		{
+			name: "label not a number",
+			text: "1,2,0.5\n3,4,high\n",
+			opts: LoadOptions{NumericLabel: true},
+			row:  2,
+			col:  3,
+			err:  errNumericLabel,
+		},
+		{
+			name: "output not a number",
+			text: "x,out,y\n1,u,0.5\n",
+			opts: LoadOptions{Header: true, Outputs: []string{"out"}, NumericLabel: true},
+			row:  2,
+			col:  2,
+			err:  errNumericLabel,
+		},
+		{
+			name: "negative weight",
+			text: "x,w,class\n1,1,a\n2,0.5,b\n3,-1,a\n",
+			opts: LoadOptions{Header: true, Weight: "w"},
+			row:  4,
+			col:  2,
+			err:  errBadWeight,
+		},
+		{
+			name: "weight not a number",
+			text: "1,heavy,a\n2,1,b\n",
+			opts: LoadOptions{Weight: "1"},
+			row:  1,
+			col:  2,
+			err:  errBadWeight,
+		},
+		{
+			name: "bare quote",
+			text: "1,2,a\n3,4\"5,b\n",
+			row:  2,
+			col:  4,
+			err:  csv.ErrBareQuote,
+		},
+		{
+			name: "wrong number of fields",
+			text: "1,2,a\n3,4,b\n5,6\n",
+			row:  3,
+			col:  1,
+			err:  csv.ErrFieldCount,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadDataset(writeCSV(t, test.text), test.opts)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got error %v, want a ParseError", err)
+			}
+			if parseErr.Row != test.row || parseErr.Col != test.col {
+				t.Errorf("got row %d, column %d, want row %d, column %d", parseErr.Row, parseErr.Col, test.row, test.col)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
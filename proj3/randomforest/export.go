@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Function to write the label of a node of the dot graph
+func (T *Tree) dotLabel(node *DNode, columns []Column, label Column) string {
+	var lines []string
+	if node.nodeType != "leaf" && len(node.children) == 2 {
+		step := node.step(true)
+		lines = append(lines, step.rule(columns))
+	}
+	lines = append(lines, fmt.Sprintf("samples = %d", node.nSamples))
+	if T.regression {
+		lines = append(lines, fmt.Sprintf("variance = %.6g", node.impurity))
+		lines = append(lines, fmt.Sprintf("value = %.6g", node.predictedClass))
+	} else {
+		lines = append(lines, fmt.Sprintf("[%s]", distributionString(node, label)))
+		lines = append(lines, fmt.Sprintf("class = %s", label.level(node.predictedClass)))
+	}
+	return strings.ReplaceAll(strings.Join(lines, "\\n"), "\"", "\\\"")
+}
+
+// Helper function to WriteDot, returning the id of the next node
+func (T *Tree) writeDotNode(w io.Writer, node *DNode, id int, columns []Column, label Column) int {
+	fmt.Fprintf(w, "  %d [label=\"%s\"];\n", id, T.dotLabel(node, columns, label))
+	next := id + 1
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return next
+	}
+	for k, edge := range []string{"true", "false"} {
+		fmt.Fprintf(w, "  %d -> %d [label=\"%s\"];\n", id, next, edge)
+		next = T.writeDotNode(w, &node.children[k], next, columns, label)
+	}
+	return next
+}
+
+// WriteDot writes the tree as a Graphviz dot graph. Every node shows its
+// test, the number of training rows reaching it, their classes and the
+// class it predicts, or the value it predicts in a regression tree. The left
+// child is the one where the test is true
+func (T *Tree) WriteDot(w io.Writer, columns []Column, label Column) {
+	fmt.Fprintln(w, "digraph Tree {")
+	fmt.Fprintln(w, "  node [shape=box, fontname=\"helvetica\"];")
+	T.writeDotNode(w, &T.root, 0, columns, label)
+	fmt.Fprintln(w, "}")
+}
+
+// Helper function to WriteRules
+func (T *Tree) writeRulesNode(w io.Writer, node *DNode, depth int, columns []Column, label Column) {
+	indent := strings.Repeat("    ", depth)
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		if T.regression {
+			fmt.Fprintf(w, "%svalue = %.6g  # %d rows\n", indent, node.predictedClass, node.nSamples)
+			return
+		}
+		fmt.Fprintf(w, "%sclass = %s  # %d rows [%s]\n", indent, label.level(node.predictedClass), node.nSamples, distributionString(node, label))
+		return
+	}
+	step := node.step(true)
+	fmt.Fprintf(w, "%sif %s {\n", indent, step.rule(columns))
+	T.writeRulesNode(w, &node.children[0], depth+1, columns, label)
+	fmt.Fprintf(w, "%s} else {\n", indent)
+	T.writeRulesNode(w, &node.children[1], depth+1, columns, label)
+	fmt.Fprintf(w, "%s}\n", indent)
+}
+
+// WriteRules writes the tree as nested if/else rules
+func (T *Tree) WriteRules(w io.Writer, columns []Column, label Column) {
+	T.writeRulesNode(w, &T.root, 0, columns, label)
+}
+
+// Function to run the export subcommand: export -model file -tree k [-format dot|rules] [-out file]
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	modelPath := fs.String("model", "", "the saved model to read")
+	treeIndex := fs.Int("tree", 0, "index of the tree to export")
+	format := fs.String("format", "dot", "dot or rules")
+	out := fs.String("out", "", "the file to write, the standard output by default")
+	fs.Parse(args)
+
+	if *modelPath == "" {
+		log.Fatal("export needs -model")
+	}
+	forest, err := LoadForest(*modelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *treeIndex < 0 || *treeIndex >= len(forest.trees) {
+		log.Fatalf("tree %d is out of range for %d trees", *treeIndex, len(forest.trees))
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	tree := forest.trees[*treeIndex]
+	switch *format {
+	case "dot":
+		tree.WriteDot(w, forest.columns, forest.label)
+	case "rules":
+		tree.WriteRules(w, forest.columns, forest.label)
+	default:
+		log.Fatalf("unknown export format %q", *format)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Helper function to importance for extremely randomized trees. A numeric
+// column is split at a single point drawn uniformly between its smallest and
+// largest value in the node, and a categorical column sends a random subset
+// of its categories in the node to the left child. The impurity of that split
+// is returned with its split value or set of categories, the impurity being
+// infinite if the column has a single value in the node, if a child would
+// have fewer rows than minSamplesLeaf or if the mean of the children goes
+// against the direction of a monotonic constraint
+func (T *Tree) importanceRandom(X []float64, y []float64, w []float64, categorical bool, direction int) (float64, float64, map[float64]bool) {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, v := range X {
+		minX = math.Min(minX, v)
+		maxX = math.Max(maxX, v)
+	}
+	if !(minX < maxX) {
+		return math.Inf(2), math.Inf(2), nil
+	}
+
+	var val float64
+	var leftSet map[float64]bool
+	goesLeft := func(v float64) bool { return v < val }
+	if categorical {
+		leftSet = randomCategories(X, T.rng)
+		goesLeft = func(v float64) bool { return leftSet[v] }
+	} else {
+		val = minX + T.rng.Float64()*(maxX-minX)
+		if val == minX {
+			val = math.Nextafter(minX, maxX)
+		}
+	}
+
+	var yLeft, wLeft, yRight, wRight []float64
+	for k, v := range X {
+		if goesLeft(v) {
+			yLeft, wLeft = append(yLeft, y[k]), append(wLeft, w[k])
+		} else {
+			yRight, wRight = append(yRight, y[k]), append(wRight, w[k])
+		}
+	}
+	nLeft, nRight := sum(wLeft), sum(wRight)
+	total := nLeft + nRight
+	if len(yLeft) < T.minSamplesLeaf || len(yRight) < T.minSamplesLeaf || total <= 0 {
+		return math.Inf(2), val, leftSet
+	}
+	if direction != 0 && !categorical && nLeft > 0 && nRight > 0 {
+		gap := weightedMean(yRight, wRight) - weightedMean(yLeft, wLeft)
+		if float64(direction)*gap < 0 {
+			return math.Inf(2), val, leftSet
+		}
+	}
+	thisEntropy := nLeft/total*T.impurity(yLeft, wLeft) + nRight/total*T.impurity(yRight, wRight)
+	return thisEntropy, val, leftSet
+}
+
+// Function to pick a random subset of the categories in X that is neither
+// empty nor all of them
+func randomCategories(X []float64, rng *rand.Rand) map[float64]bool {
+	seen := make(map[float64]bool)
+	var cats []float64
+	for _, v := range X {
+		if !seen[v] {
+			seen[v] = true
+			cats = append(cats, v)
+		}
+	}
+	sort.Float64s(cats)
+	rng.Shuffle(len(cats), func(a, b int) { cats[a], cats[b] = cats[b], cats[a] })
+
+	leftSet := make(map[float64]bool)
+	for _, cat := range cats[:1+rng.Intn(len(cats)-1)] {
+		leftSet[cat] = true
+	}
+	return leftSet
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"math/rand"
+	"proj3/concurrent"
+	"sort"
+)
+
+// Settings used to grow every tree of the forest
+type ForestConfig struct {
+	maxDepth int
+
+	// The number of columns picked at random for each tree, from the
+	// columns in features or from all the columns if features is nil
+	sqrtCols int
+	features []int
+
+	// Which of the columns of the data are categorical
+	categorical []bool
+
+	// If each tree is trained on a bootstrap sample of the training rows
+	bootstrap bool
+
+	// The number of rows of each class in the bootstrap sample of every tree
+	// of a balanced random forest, nil to draw the rows regardless of class
+	classCounts []int
+
+	// Stopping rules of the trees
+	minSamplesSplit     int
+	minSamplesLeaf      int
+	minImpurityDecrease float64
+	maxLeafNodes        int
+
+	// The trees are pruned with minimal cost-complexity pruning at this alpha
+	ccpAlpha float64
+
+	// The weight of every row of the data, nil if the rows weigh the same,
+	// and the column and the class weights they were found from as given on
+	// the command line, so that a warm start weighs its rows the same way
+	weights      []float64
+	weightColumn string
+	classWeight  string
+
+	// If the trees are extremely randomized trees
+	extraTrees bool
+
+	// If the trees are regression trees, and if their leaves keep the y
+	// values of their rows to find quantiles
+	regression bool
+	keepValues bool
+
+	// The monotonic constraint of every column of the data, 1 if the
+	// prediction may only go up as the column grows, -1 if it may only go
+	// down and 0 if it is free, nil if no column is constrained
+	monotone []int
+}
+
+// Function to create an untrained tree with the settings of the forest,
+// splitting on the given columns of the data and drawing its random numbers
+// from the seed
+func (config *ForestConfig) newTree(features []int, seed int64) *Tree {
+	return &Tree{
+		maxDepth:            config.maxDepth,
+		features:            features,
+		categorical:         config.categorical,
+		minSamplesSplit:     config.minSamplesSplit,
+		minSamplesLeaf:      config.minSamplesLeaf,
+		minImpurityDecrease: config.minImpurityDecrease,
+		maxLeafNodes:        config.maxLeafNodes,
+		weights:             config.weights,
+		extraTrees:          config.extraTrees,
+		regression:          config.regression,
+		keepValues:          config.keepValues,
+		monotone:            config.monotone,
+		seed:                seed,
+		rng:                 rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Function to pick the columns a tree may split on at random: sqrtCols of
+// the columns in features, or of all the columns if features is nil
+func (config *ForestConfig) pickColumns(rng *rand.Rand, cols int) []int {
+	if config.features == nil {
+		return rng.Perm(cols)[:config.sqrtCols]
+	}
+	var thisCols []int
+	for _, p := range rng.Perm(len(config.features))[:config.sqrtCols] {
+		thisCols = append(thisCols, config.features[p])
+	}
+	return thisCols
+}
+
+// The Random Forest: the trained trees and the columns of the data they
+// were trained on. The trees are gradient boosted trees if boost is set
+type Forest struct {
+	trees   []*Tree
+	columns []Column
+	label   Column
+	config  *ForestConfig
+	boost   *Boosting
+
+	// The calibration of the class probabilities, nil if they are not
+	// calibrated
+	calibration *Calibration
+
+	// The label of every output of a multi-output forest, the label first,
+	// nil if the forest predicts the label alone
+	outputs []Column
+
+	// The seed the data was split into train and test with and the seeds of
+	// the trees derive from, 0 if unknown, and the number of rows of the data
+	seed int64
+	rows int
+}
+
+// The uses of the seed of a run other than growing the trees of the forest,
+// each drawing from its own seed derived with streamSeed
+const (
+	permutationStream = iota
+	pruneStream
+	boostStream
+	isolationStream
+	mdsStream
+	imputeStream
+)
+
+// Function to derive the seed of one use of the seed of a run, apart from
+// the seeds of the trees
+func streamSeed(seed int64, stream int) int64 {
+	return treeSeed(seed, -1-stream)
+}
+
+// Function to derive the seed of tree t of a forest from the seed of the
+// forest, mixing the bits so that nearby trees get unrelated seeds
+func treeSeed(seed int64, t int) int64 {
+	z := uint64(seed) + uint64(t+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// Function to draw as many rows as there are in train, with replacement.
+// The rows of train that were never drawn are returned as the out-of-bag rows
+func bootstrapSample(train []int, rng *rand.Rand) ([]int, []int) {
+	sample := make([]int, len(train))
+	drawn := make([]bool, len(train))
+	for k := range sample {
+		pos := rng.Intn(len(train))
+		sample[k] = train[pos]
+		drawn[pos] = true
+	}
+	var oob []int
+	for pos, i := range train {
+		if !drawn[pos] {
+			oob = append(oob, i)
+		}
+	}
+	return sample, oob
+}
+
+// Function to get the predictions of every tree for the rows idx of the data.
+// Gradient boosted trees give the single prediction of all of them together
+func (F *Forest) predict(X Matrix, idx []int) [][]float64 {
+	if F.boost != nil {
+		pred := make([]float64, len(idx))
+		for j, raw := range F.rawScores(X, idx) {
+			pred[j] = F.boost.prediction(raw)
+		}
+		return [][]float64{pred}
+	}
+	var yPred [][]float64
+	for _, tree := range F.trees {
+		yPred = append(yPred, tree.predict(X, idx))
+	}
+	return yPred
+}
+
+// Function to check if the forest predicts the values of the label, as a
+// regression forest or with the squared loss of boosting, instead of classes
+func (F *Forest) isRegression() bool {
+	if F.boost != nil {
+		return F.boost.loss == "squared"
+	}
+	return F.config != nil && F.config.regression
+}
+
+// Function to find the predictions of the forest for the rows idx of the
+// data: the class with the most votes, or the mean of the values of the
+// trees for a regression forest
+func (F *Forest) predictions(X Matrix, idx []int) []float64 {
+	yPred := F.predict(X, idx)
+	if F.boost != nil || !F.isRegression() {
+		return Vote(yPred)
+	}
+	mean := make([]float64, len(idx))
+	for _, pred := range yPred {
+		for j, v := range pred {
+			mean[j] += v / float64(len(yPred))
+		}
+	}
+	return mean
+}
+
+// Function to find the accuracy of the forest on the rows idx of the data,
+// or the R2 of its predictions if it predicts the values of the label. y
+// holds the classes of the rows, or their values for a regression forest
+func (F *Forest) score(X Matrix, y []float64, idx []int) float64 {
+	yPred2 := F.predictions(X, idx)
+	if F.isRegression() {
+		_, r2 := RegressionScores(yPred2, pick(y, idx))
+		return r2
+	}
+	acc := 0
+	for k, i := range idx {
+		if yPred2[k] == y[i] {
+			acc++
+		}
+	}
+	return float64(acc) / float64(len(idx))
+}
+
+// Function to find the out-of-bag accuracy of the forest, or its R2 for a
+// regression forest: every row is predicted only by the trees that did not
+// see it during training
+func (F *Forest) oobScore(X Matrix, y []float64) float64 {
+	votes := make(map[int][]float64)
+	for _, tree := range F.trees {
+		for k, pred := range tree.predict(X, tree.oob) {
+			votes[tree.oob[k]] = append(votes[tree.oob[k]], pred)
+		}
+	}
+	if len(votes) == 0 {
+		return 0
+	}
+	if F.isRegression() {
+		// The rows in order, so that the same forest gets the same score
+		var idx []int
+		for i := range votes {
+			idx = append(idx, i)
+		}
+		sort.Ints(idx)
+		yPred := make([]float64, len(idx))
+		for k, i := range idx {
+			yPred[k] = sum(votes[i]) / float64(len(votes[i]))
+		}
+		_, r2 := RegressionScores(yPred, pick(y, idx))
+		return r2
+	}
+	acc := 0
+	for i, v := range votes {
+		if mostFrequent(v) == y[i] {
+			acc++
+		}
+	}
+	return float64(acc) / float64(len(votes))
+}
+
+// Function to run the tasks and return their results in the order of the
+// tasks. The tasks are run one after the other if there is no executor
+func runTasks(executor concurrent.ExecutorService, tasks []concurrent.Callable) []interface{} {
+	var results []interface{}
+	if executor == nil {
+		for _, task := range tasks {
+			results = append(results, task.Call())
+		}
+		return results
+	}
+
+	var futures []concurrent.Future
+	for _, task := range tasks {
+		futures = append(futures, executor.Submit(task))
+	}
+	for _, future := range futures {
+		results = append(results, future.Get())
+	}
+	return results
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"proj3/concurrent"
+	"sort"
+)
+
+// Function to find the decrease in impurity brought by each feature of the
+// data over all the splits of the tree, weighted by the weight of the rows
+// reaching the split and normalized to sum to 1
+func (T *Tree) featureImportances(cols int) []float64 {
+	imp := make([]float64, cols)
+	T.root.impurityDecrease(imp)
+	normalize(imp)
+	return imp
+}
+
+// Helper function to featureImportances
+func (node *DNode) impurityDecrease(imp []float64) {
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return
+	}
+	left, right := &node.children[0], &node.children[1]
+	decrease := node.weight*node.impurity - left.weight*left.impurity - right.weight*right.impurity
+	imp[node.testAttribute] += decrease
+	left.impurityDecrease(imp)
+	right.impurityDecrease(imp)
+}
+
+// Function to scale the values so that they sum to 1
+func normalize(arr []float64) {
+	sum := 0.0
+	for _, v := range arr {
+		sum += v
+	}
+	if sum <= 0 {
+		return
+	}
+	for j := range arr {
+		arr[j] /= sum
+	}
+}
+
+// FeatureImportances returns the mean decrease in impurity of every column of
+// the data, averaged over the trees of the forest and normalized to sum to 1
+func (F *Forest) FeatureImportances() []float64 {
+	imp := make([]float64, len(F.columns))
+	for _, tree := range F.trees {
+		for j, v := range tree.featureImportances(len(F.columns)) {
+			imp[j] += v
+		}
+	}
+	normalize(imp)
+	return imp
+}
+
+// Function to print the top features ranked by their importance. All the
+// features are printed if top is not positive
+func PrintImportances(imp []float64, columns []Column, top int) {
+	order := make([]int, len(imp))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool { return imp[order[a]] > imp[order[b]] })
+	if top <= 0 || top > len(order) {
+		top = len(order)
+	}
+
+	fmt.Printf("%-6s %-20s %10s\n", "rank", "feature", "importance")
+	for k, j := range order[:top] {
+		fmt.Printf("%-6d %-20s %10.4f\n", k+1, columns[j].name, imp[j])
+	}
+}
+
+// Matrix reading one of its columns through a permutation of the rows, so
+// that the column can be shuffled without copying the data
+type permutedMatrix struct {
+	Matrix
+	col  int
+	perm map[int]int
+}
+
+func (M *permutedMatrix) At(i, j int) float64 {
+	if j == M.col {
+		if p, ok := M.perm[i]; ok {
+			return M.Matrix.At(p, j)
+		}
+	}
+	return M.Matrix.At(i, j)
+}
+
+// Function to shuffle the column col between the rows idx of the data
+func permuteColumn(X Matrix, idx []int, col int, rng *rand.Rand) Matrix {
+	perm := make(map[int]int, len(idx))
+	for k, p := range rng.Perm(len(idx)) {
+		perm[idx[k]] = idx[p]
+	}
+	return &permutedMatrix{Matrix: X, col: col, perm: perm}
+}
+
+// Creating a callable scoring the forest once a column has been shuffled
+type PermutationTask struct {
+	forest *Forest
+	X      Matrix
+	y      []float64
+	idx    []int
+	col    int
+	oob    bool
+	seed   int64
+}
+
+// Defining the Call function for the Executor
+func (task *PermutationTask) Call() interface{} {
+	X := permuteColumn(task.X, task.idx, task.col, rand.New(rand.NewSource(task.seed)))
+	if task.oob {
+		return task.forest.oobScore(X, task.y)
+	}
+	return task.forest.score(X, task.y, task.idx)
+}
+
+// PermutationImportances returns, for every column of the data, the mean and
+// standard deviation over the repeats of the drop in accuracy when the column
+// is shuffled. The forest is scored on the rows idx of the data, or on the
+// out-of-bag rows of its trees if oob is set. Every shuffle is a task run on
+// the executor, shuffling with a seed derived from seed
+func (F *Forest) PermutationImportances(executor concurrent.ExecutorService, X Matrix, y []float64, idx []int, repeats int, oob bool, seed int64) ([]float64, []float64) {
+	var baseline float64
+	if oob {
+		idx = nil
+		seen := make(map[int]bool)
+		for _, tree := range F.trees {
+			for _, i := range tree.oob {
+				if !seen[i] {
+					seen[i] = true
+					idx = append(idx, i)
+				}
+			}
+		}
+		baseline = F.oobScore(X, y)
+	} else {
+		baseline = F.score(X, y, idx)
+	}
+
+	cols := X.Cols()
+	var tasks []concurrent.Callable
+	for j := 0; j < cols; j++ {
+		for r := 0; r < repeats; r++ {
+			tasks = append(tasks, &PermutationTask{forest: F, X: X, y: y, idx: idx, col: j, oob: oob, seed: treeSeed(seed, j*repeats+r)})
+		}
+	}
+	results := runTasks(executor, tasks)
+
+	mean := make([]float64, cols)
+	std := make([]float64, cols)
+	for j := 0; j < cols; j++ {
+		drops := make([]float64, repeats)
+		for r := 0; r < repeats; r++ {
+			drops[r] = baseline - results[j*repeats+r].(float64)
+			mean[j] += drops[r] / float64(repeats)
+		}
+		for r := 0; r < repeats; r++ {
+			std[j] += (drops[r] - mean[j]) * (drops[r] - mean[j]) / float64(repeats)
+		}
+		std[j] = math.Sqrt(std[j])
+	}
+	return mean, std
+}
+
+// Function to print the top features ranked by their permutation importance.
+// All the features are printed if top is not positive
+func PrintPermutationImportances(mean []float64, std []float64, columns []Column, top int) {
+	order := make([]int, len(mean))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool { return mean[order[a]] > mean[order[b]] })
+	if top <= 0 || top > len(order) {
+		top = len(order)
+	}
+
+	fmt.Printf("%-6s %-20s %10s %10s\n", "rank", "feature", "mean drop", "std")
+	for k, j := range order[:top] {
+		fmt.Printf("%-6d %-20s %10.4f %10.4f\n", k+1, columns[j].name, mean[j], std[j])
+	}
+}
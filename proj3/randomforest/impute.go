@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"proj3/concurrent"
+	"sort"
+	"strconv"
+)
+
+// The change of the imputed values between two iterations of Impute: the
+// squared change of the numeric values over their squared size and the
+// share of the categorical values that changed
+type ImputeStep struct {
+	numeric     float64
+	categorical float64
+}
+
+// Function to fill the missing values of every column with the mean of the
+// numeric columns or the most frequent category of the categorical ones
+func initialFill(X *ColMatrix, columns []Column, missing [][]int) {
+	for j, rows := range missing {
+		if len(rows) == 0 {
+			continue
+		}
+		isMissing := make(map[int]bool)
+		for _, i := range rows {
+			isMissing[i] = true
+		}
+		var observed []float64
+		for i := 0; i < X.Rows(); i++ {
+			if !isMissing[i] {
+				observed = append(observed, X.At(i, j))
+			}
+		}
+		fill := 0.0
+		if columns[j].categorical {
+			fill = mostFrequent(observed)
+		} else if len(observed) > 0 {
+			fill = sum(observed) / float64(len(observed))
+		}
+		for _, i := range rows {
+			X.Set(i, j, fill)
+		}
+	}
+}
+
+// Function to drop the categories standing for missing values from the
+// categorical columns with missing values, so that no split is made on them
+// and no cell is imputed to them. The other categories keep their order
+func dropMissingLevels(X *ColMatrix, columns []Column, missing [][]int) {
+	for j, rows := range missing {
+		col := &columns[j]
+		if !col.categorical || len(rows) == 0 || len(rows) == X.Rows() {
+			continue
+		}
+		levels := col.levels
+		col.levels, col.codes = nil, make(map[string]int)
+		recode := make([]float64, len(levels))
+		for k, level := range levels {
+			recode[k] = -1
+			if !isMissing(level) {
+				recode[k] = col.encode(level)
+			}
+		}
+		for i := 0; i < X.Rows(); i++ {
+			if k := int(X.At(i, j)); k >= 0 && k < len(recode) {
+				X.Set(i, j, recode[k])
+			}
+		}
+	}
+}
+
+// Impute fills the missing values of the dataset with missForest: after an
+// initial fill with the mean or the most frequent category, every column
+// with missing values, from the one with the fewest, is predicted from the
+// other columns by a forest trained on the rows where it is known, a
+// regression forest for numeric columns and a classification forest for
+// categorical ones. The categories of missing values are dropped first.
+// The iterations stop once neither kind of change gets
+// smaller, keeping the imputation before it, or after maxIter iterations.
+// The trees of every forest are trained on bootstrap samples on the
+// executor with the settings of the trees in config, each from its own seed
+// derived from seed, and the changes of every iteration are returned
+func Impute(executor concurrent.ExecutorService, ds *Dataset, trees int, config *ForestConfig, maxIter int, seed int64) ([]ImputeStep, error) {
+	X, ok := ds.X.(*ColMatrix)
+	if !ok {
+		return nil, errors.New("only dense data can be imputed")
+	}
+	var order []int
+	for j, rows := range ds.missing {
+		if len(rows) > 0 && len(rows) < X.Rows() {
+			order = append(order, j)
+		}
+	}
+	if len(order) == 0 {
+		return nil, errors.New("no column has missing values to impute")
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(ds.missing[order[a]]) < len(ds.missing[order[b]]) })
+	dropMissingLevels(X, ds.columns, ds.missing)
+	initialFill(X, ds.columns, ds.missing)
+
+	cols := X.Cols()
+	sqrtCols := int(math.Round(math.Sqrt(float64(cols))))
+	if sqrtCols < 1 {
+		sqrtCols = 1
+	}
+	if sqrtCols > cols-1 {
+		sqrtCols = cols - 1
+	}
+
+	var steps []ImputeStep
+	grown := 0
+	for iter := 0; iter < maxIter; iter++ {
+
+		// Keeping the imputed values to compare them and to go back to them
+		current := make([][]float64, cols)
+		for _, j := range order {
+			current[j] = column(X, ds.missing[j], j)
+		}
+
+		for _, j := range order {
+			missing := make(map[int]bool)
+			for _, i := range ds.missing[j] {
+				missing[i] = true
+			}
+			var observed []int
+			for i := 0; i < X.Rows(); i++ {
+				if !missing[i] {
+					observed = append(observed, i)
+				}
+			}
+
+			// The classes of the label play no part in the imputation
+			grow := *config
+			grow.sqrtCols, grow.features = sqrtCols, nil
+			grow.bootstrap, grow.classCounts, grow.weights = true, nil, ds.weights
+			grow.regression, grow.keepValues = !ds.columns[j].categorical, false
+			grow.categorical = make([]bool, cols)
+			for k := 0; k < cols; k++ {
+				grow.categorical[k] = ds.columns[k].categorical
+				if k != j {
+					grow.features = append(grow.features, k)
+				}
+			}
+
+			target := column(X, allRows(X.Rows()), j)
+			var tasks []concurrent.Callable
+			for t := 0; t < trees; t++ {
+				tasks = append(tasks, NewSeededTask(X, target, observed, &grow, treeSeed(seed, grown)))
+				grown++
+			}
+			forest := &Forest{config: &grow}
+			for _, result := range runTasks(executor, tasks) {
+				forest.trees = append(forest.trees, result.(*Tree))
+			}
+			for k, v := range forest.predictions(X, ds.missing[j]) {
+				X.Set(ds.missing[j][k], j, v)
+			}
+		}
+
+		// Measuring how much the imputed values changed
+		var step ImputeStep
+		sumNum, sizeNum, changedCat, totalCat := 0.0, 0.0, 0, 0
+		for _, j := range order {
+			for k, i := range ds.missing[j] {
+				v := X.At(i, j)
+				if ds.columns[j].categorical {
+					totalCat++
+					if v != current[j][k] {
+						changedCat++
+					}
+				} else {
+					sumNum += (v - current[j][k]) * (v - current[j][k])
+					sizeNum += v * v
+				}
+			}
+		}
+		if sizeNum > 0 {
+			step.numeric = sumNum / sizeNum
+		}
+		if totalCat > 0 {
+			step.categorical = float64(changedCat) / float64(totalCat)
+		}
+		steps = append(steps, step)
+
+		// Stopping once neither change got smaller, with the values before
+		if iter > 0 {
+			last := steps[len(steps)-2]
+			if step.numeric >= last.numeric && step.categorical >= last.categorical {
+				for _, j := range order {
+					for k, i := range ds.missing[j] {
+						X.Set(i, j, current[j][k])
+					}
+				}
+				break
+			}
+		}
+	}
+	return steps, nil
+}
+
+// Function to get the rows 0 to n-1
+func allRows(n int) []int {
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
+
+// Function to print the changes of the imputed values at every iteration
+func PrintImputeSteps(steps []ImputeStep) {
+	fmt.Printf("%-10s %14s %14s\n", "iteration", "numeric", "categorical")
+	for k, step := range steps {
+		fmt.Printf("%-10d %14.6f %14.6f\n", k+1, step.numeric, step.categorical)
+	}
+}
+
+// WriteImputed writes the csv file at source, read with opts, to path with
+// the missing values of its feature columns replaced by their imputed
+// values. Every other cell, the header and the order of the columns are kept
+// as they are in the file. Categorical values are written as their categories
+func WriteImputed(path string, source string, ds *Dataset, opts LoadOptions) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	csvReader, _, err := openRecords(in, opts.Delimiter)
+	if err != nil {
+		return err
+	}
+
+	// The feature columns imputed in every row
+	imputed := make([][]int, ds.X.Rows())
+	for k, rows := range ds.missing {
+		if len(rows) == ds.X.Rows() {
+			continue
+		}
+		for _, i := range rows {
+			imputed[i] = append(imputed[i], k)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if opts.Delimiter != 0 {
+		w.Comma = opts.Delimiter
+	}
+	if opts.Header {
+		record, err := nextRecord(csvReader)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		w.Write(record)
+	}
+	for i := 0; i < ds.X.Rows(); i++ {
+		record, err := nextRecord(csvReader)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		for _, k := range imputed[i] {
+			v := ds.X.At(i, k)
+			if ds.columns[k].categorical {
+				record[ds.sources[k]] = ds.columns[k].level(v)
+			} else {
+				record[ds.sources[k]] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
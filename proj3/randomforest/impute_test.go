@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteImputed(t *testing.T) {
+	var text strings.Builder
+	text.WriteString("w;a;cat;y;b\n")
+	for i := 0; i < 60; i++ {
+		a, cat, b := fmt.Sprint(i%10), []string{"x", "y", "z"}[i%3], fmt.Sprint(2*(i%10))
+		if i%7 == 0 {
+			a = "?"
+		}
+		if i%5 == 0 {
+			cat = "?"
+		}
+		if i%11 == 0 {
+			b = ""
+		}
+		fmt.Fprintf(&text, "%d;%s;%s;%d;%s\n", 1+i%2, a, cat, i%2, b)
+	}
+	source := writeCSV(t, text.String())
+	opts := LoadOptions{Header: true, Delimiter: ';', Label: "y", Weight: "w", Categorical: []string{"cat"}}
+	ds, err := LoadDataset(source, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Impute(nil, ds, 5, &ForestConfig{maxDepth: 4}, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "imputed.csv")
+	if err := WriteImputed(path, source, ds, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(path string) [][]string {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r := csv.NewReader(f)
+		r.Comma = ';'
+		records, err := r.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	want, got := read(source), read(path)
+	if len(got) != len(want) || !reflect.DeepEqual(got[0], want[0]) {
+		t.Fatalf("got %d rows with the header %v, want %d with %v", len(got), got[0], len(want), want[0])
+	}
+
+	// Only the missing cells change, and never to a missing value
+	for i := 1; i < len(want); i++ {
+		for j, cell := range want[i] {
+			switch {
+			case isMissing(cell) && isMissing(got[i][j]):
+				t.Errorf("row %d, column %d was not imputed", i, j)
+			case !isMissing(cell) && got[i][j] != cell:
+				t.Errorf("row %d, column %d went from %q to %q", i, j, cell, got[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"proj3/concurrent"
+	"sort"
+	"strconv"
+)
+
+// The Isolation Forest: trees splitting random samples of the rows on a
+// random column at a random point until every row is on its own. Anomalies
+// are isolated closer to the root than the other rows
+type IsolationForest struct {
+	trees []*Tree
+
+	// The number of rows each tree is grown on
+	sampleSize int
+
+	// The rows with a score of at least the threshold are anomalies
+	threshold float64
+}
+
+// Function to find the average path length of an unsuccessful search in a
+// binary search tree of n rows, which normalizes the path lengths of the
+// isolation trees
+func averagePathLength(n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	if n == 2 {
+		return 1
+	}
+	return 2*(math.Log(float64(n-1))+0.5772156649) - 2*float64(n-1)/float64(n)
+}
+
+// Function to grow an isolation tree on the rows idx of the data. A node is
+// split on a column picked at random among those with more than one value
+// in the node, at a point drawn uniformly between the smallest and largest
+// value (a random subset of the categories for categorical columns)
+func (T *Tree) isolationBuildTree(X Matrix, idx []int, currDepth int) DNode {
+	node := DNode{nodeType: "leaf", nSamples: len(idx), weight: float64(len(idx))}
+	if currDepth >= T.maxDepth || len(idx) <= 1 {
+		return node
+	}
+
+	for _, p := range T.rng.Perm(len(T.features)) {
+		j := T.features[p]
+		values := column(X, idx, j)
+		minX, maxX := math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			minX = math.Min(minX, v)
+			maxX = math.Max(maxX, v)
+		}
+		if !(minX < maxX) {
+			continue
+		}
+
+		node.nodeType, node.testAttribute = "", j
+		if T.isCategorical(j) {
+			node.categorical, node.leftCategories = true, randomCategories(values, T.rng)
+		} else {
+			node.testValue = minX + T.rng.Float64()*(maxX-minX)
+			if node.testValue == minX {
+				node.testValue = math.Nextafter(minX, maxX)
+			}
+		}
+		left, right := node.partition(X, idx)
+		node.children = []DNode{T.isolationBuildTree(X, left, currDepth+1), T.isolationBuildTree(X, right, currDepth+1)}
+		return node
+	}
+
+	// Every column has a single value, so the rows cannot be told apart
+	return node
+}
+
+// Function to find the path length of row i of the data in the isolation
+// tree: the depth of its leaf plus the average path length of the rows left
+// together in that leaf
+func (T *Tree) pathLength(X Matrix, i int) float64 {
+	depth := 0
+	thisNode := &T.root
+	for thisNode.nodeType != "leaf" && len(thisNode.children) == 2 {
+		if thisNode.goesLeft(X, i) {
+			thisNode = &thisNode.children[0]
+		} else {
+			thisNode = &thisNode.children[1]
+		}
+		depth++
+	}
+	return float64(depth) + averagePathLength(thisNode.nSamples)
+}
+
+// Creating a callable growing one isolation tree
+type IsolationTask struct {
+	X           Matrix
+	rows        []int
+	sampleSize  int
+	maxDepth    int
+	features    []int
+	categorical []bool
+	seed        int64
+}
+
+// Defining the Call function for the Executor. The tree is grown on a
+// sample of the rows drawn without replacement, from the seed
+func (task *IsolationTask) Call() interface{} {
+	rng := rand.New(rand.NewSource(task.seed))
+	sample := make([]int, task.sampleSize)
+	for k, p := range rng.Perm(len(task.rows))[:task.sampleSize] {
+		sample[k] = task.rows[p]
+	}
+	tree := &Tree{maxDepth: task.maxDepth, features: task.features, categorical: task.categorical, seed: task.seed, rng: rng}
+	tree.root = tree.isolationBuildTree(task.X, sample, 0)
+	return tree
+}
+
+// IsolationFit grows an Isolation Forest of the given number of trees on the
+// rows of the data, each tree on sampleSize rows and up to maxDepth deep
+// (the log2 of sampleSize rounded up if maxDepth is not positive), on the
+// executor. The threshold flags the share contamination of the rows with
+// the highest scores as anomalies, or the rows scoring above 0.5 if
+// contamination is 0. Tree k is grown from the seed treeSeed(seed, k)
+func IsolationFit(executor concurrent.ExecutorService, X Matrix, rows []int, categorical []bool, trees int, sampleSize int, maxDepth int, contamination float64, seed int64) *IsolationForest {
+	if sampleSize <= 0 || sampleSize > len(rows) {
+		sampleSize = len(rows)
+	}
+	if maxDepth <= 0 {
+		maxDepth = int(math.Ceil(math.Log2(math.Max(float64(sampleSize), 2))))
+	}
+	features := make([]int, X.Cols())
+	for j := range features {
+		features[j] = j
+	}
+
+	var tasks []concurrent.Callable
+	for k := 0; k < trees; k++ {
+		tasks = append(tasks, &IsolationTask{X: X, rows: rows, sampleSize: sampleSize, maxDepth: maxDepth, features: features, categorical: categorical, seed: treeSeed(seed, k)})
+	}
+	F := &IsolationForest{sampleSize: sampleSize, threshold: 0.5}
+	for _, result := range runTasks(executor, tasks) {
+		F.trees = append(F.trees, result.(*Tree))
+	}
+
+	if contamination > 0 {
+		scores := F.Scores(X, rows)
+		sort.Float64s(scores)
+		k := int(math.Round((1 - contamination) * float64(len(scores))))
+		if k >= len(scores) {
+			k = len(scores) - 1
+		}
+		F.threshold = scores[k]
+	}
+	return F
+}
+
+// Scores returns the anomaly score of the rows idx of the data, 2 to the
+// power of minus their mean path length over the average path length of
+// the samples. Scores close to 1 are anomalies and scores well below 0.5
+// are normal rows
+func (F *IsolationForest) Scores(X Matrix, idx []int) []float64 {
+	norm := averagePathLength(F.sampleSize)
+	scores := make([]float64, len(idx))
+	for k, i := range idx {
+		mean := 0.0
+		for _, tree := range F.trees {
+			mean += tree.pathLength(X, i) / float64(len(F.trees))
+		}
+		if norm > 0 {
+			scores[k] = math.Pow(2, -mean/norm)
+		}
+	}
+	return scores
+}
+
+// Function to print the number of anomalies, how they are spread over the
+// classes of the label if there is one and the top rows by score
+func PrintAnomalies(scores []float64, idx []int, threshold float64, y []float64, label Column, top int) {
+	flagged := make([]int, len(label.levels))
+	total := make([]int, len(label.levels))
+	anomalies := 0
+	for k, i := range idx {
+		if len(label.levels) > 0 {
+			total[int(y[i])]++
+		}
+		if scores[k] >= threshold {
+			anomalies++
+			if len(label.levels) > 0 {
+				flagged[int(y[i])]++
+			}
+		}
+	}
+	fmt.Printf("Threshold: %.4f\n", threshold)
+	fmt.Printf("Anomalies: %d of %d rows\n", anomalies, len(idx))
+
+	if len(label.levels) > 0 {
+		fmt.Printf("%-20s %10s %10s %10s\n", "class", "anomalies", "rows", "rate")
+		for c := range label.levels {
+			if total[c] > 0 {
+				fmt.Printf("%-20s %10d %10d %10.3f\n", label.level(float64(c)), flagged[c], total[c], float64(flagged[c])/float64(total[c]))
+			}
+		}
+	}
+
+	order := make([]int, len(idx))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if top < 0 || top > len(order) {
+		top = len(order)
+	}
+	fmt.Printf("%-8s %10s\n", "row", "score")
+	for _, k := range order[:top] {
+		if len(label.levels) > 0 {
+			fmt.Printf("%-8d %10.4f  %s\n", idx[k], scores[k], label.level(y[idx[k]]))
+		} else {
+			fmt.Printf("%-8d %10.4f\n", idx[k], scores[k])
+		}
+	}
+}
+
+// Function to write the score of every row and if it is an anomaly to a csv
+func WriteAnomalies(path string, scores []float64, idx []int, threshold float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"row", "score", "anomaly"})
+	for k, i := range idx {
+		w.Write([]string{strconv.Itoa(i), strconv.FormatFloat(scores[k], 'g', 6, 64), strconv.FormatBool(scores[k] >= threshold)})
+	}
+	w.Flush()
+	return w.Error()
+}
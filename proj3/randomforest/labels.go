@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Function to build the column holding the classes of the y variable. Each
+// distinct label gets a class index, in numeric order if all labels are
+// numbers and in alphabetical order otherwise
+func newLabelColumn(name string, values []string) Column {
+	seen := make(map[string]bool)
+	var levels []string
+	numeric := true
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		levels = append(levels, v)
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			numeric = false
+		}
+	}
+
+	sort.Slice(levels, func(a, b int) bool {
+		if numeric {
+			fa, _ := strconv.ParseFloat(levels[a], 64)
+			fb, _ := strconv.ParseFloat(levels[b], 64)
+			return fa < fb
+		}
+		return levels[a] < levels[b]
+	})
+
+	label := Column{name: name, categorical: true, codes: make(map[string]int)}
+	for _, v := range levels {
+		label.encode(v)
+	}
+	return label
+}
+
+// Function to find the class voted by most of the trees for each row
+func Vote(yPred [][]float64) []float64 {
+	var yPred2 []float64
+	for j := 0; j < len(yPred[0]); j++ {
+		yPred2 = append(yPred2, mostFrequent(ColSliceSingle(yPred, j)))
+	}
+	return yPred2
+}
+
+// Function to print the precision and recall of every class by its label
+func ClassReport(yPred2 []float64, yTest []float64, label Column) {
+	n := len(label.levels)
+	truePos := make([]int, n)
+	predicted := make([]int, n)
+	actual := make([]int, n)
+	for j := 0; j < len(yTest); j++ {
+		predicted[int(yPred2[j])]++
+		actual[int(yTest[j])]++
+		if yPred2[j] == yTest[j] {
+			truePos[int(yTest[j])]++
+		}
+	}
+
+	fmt.Printf("%-20s %10s %10s %10s\n", "class", "precision", "recall", "support")
+	for k := 0; k < n; k++ {
+		if actual[k] == 0 && predicted[k] == 0 {
+			continue
+		}
+		precision, recall := 0.0, 0.0
+		if predicted[k] > 0 {
+			precision = float64(truePos[k]) / float64(predicted[k])
+		}
+		if actual[k] > 0 {
+			recall = float64(truePos[k]) / float64(actual[k])
+		}
+		fmt.Printf("%-20s %10.3f %10.3f %10d\n", label.level(float64(k)), precision, recall, actual[k])
+	}
+
+	// The balanced accuracy is the mean recall of the classes in the data
+	recalls, classes := 0.0, 0
+	for k := 0; k < n; k++ {
+		if actual[k] > 0 {
+			recalls += float64(truePos[k]) / float64(actual[k])
+			classes++
+		}
+	}
+	if classes > 0 {
+		fmt.Printf("Balanced accuracy: %.4f\n", recalls/float64(classes))
+	}
+}
+
+// Function to write the actual and predicted labels of the test data to a
+// csv, followed by the probability of every class of each row if probs is
+// not nil
+func WritePredictions(path string, yPred2 []float64, yTest []float64, label Column, probs [][]float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"actual", "predicted"}
+	if probs != nil {
+		for c := range label.levels {
+			header = append(header, "p_"+label.level(float64(c)))
+		}
+	}
+	w.Write(header)
+	for j := 0; j < len(yTest); j++ {
+		record := []string{label.level(yTest[j]), label.level(yPred2[j])}
+		if probs != nil {
+			for _, p := range probs[j] {
+				record = append(record, strconv.FormatFloat(p, 'g', 6, 64))
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
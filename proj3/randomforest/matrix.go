@@ -0,0 +1,73 @@
+package main
+
+// Matrix of feature values that the trees are trained and evaluated on
+type Matrix interface {
+	Rows() int
+	Cols() int
+	At(i, j int) float64
+}
+
+// Dense matrix stored column by column, so that the values of one feature
+// are next to each other in memory. Either the float64 or the float32
+// storage is used
+type ColMatrix struct {
+	rows   int
+	cols   int
+	data64 []float64
+	data32 []float32
+}
+
+// NewColMatrix returns a matrix of zeros with the given size
+func NewColMatrix(rows, cols int, use32 bool) *ColMatrix {
+	M := &ColMatrix{rows: rows, cols: cols}
+	if use32 {
+		M.data32 = make([]float32, rows*cols)
+	} else {
+		M.data64 = make([]float64, rows*cols)
+	}
+	return M
+}
+
+func (M *ColMatrix) Rows() int {
+	return M.rows
+}
+
+func (M *ColMatrix) Cols() int {
+	return M.cols
+}
+
+func (M *ColMatrix) At(i, j int) float64 {
+	if M.data32 != nil {
+		return float64(M.data32[j*M.rows+i])
+	}
+	return M.data64[j*M.rows+i]
+}
+
+func (M *ColMatrix) Set(i, j int, val float64) {
+	if M.data32 != nil {
+		M.data32[j*M.rows+i] = float32(val)
+	} else {
+		M.data64[j*M.rows+i] = val
+	}
+}
+
+// Function to get the values of a column for the given rows
+func column(X Matrix, idx []int, col int) []float64 {
+	if S, ok := X.(*SparseMatrix); ok {
+		return S.gather(idx, col)
+	}
+	ArrRet := make([]float64, len(idx))
+	for k, i := range idx {
+		ArrRet[k] = X.At(i, col)
+	}
+	return ArrRet
+}
+
+// Function to get the values of a slice for the given rows
+func pick(y []float64, idx []int) []float64 {
+	ArrRet := make([]float64, len(idx))
+	for k, i := range idx {
+		ArrRet[k] = y[i]
+	}
+	return ArrRet
+}
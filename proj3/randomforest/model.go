@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Version of the format of the saved models
+const modelVersion = 1
+
+// The forest as it is written to a model file
+type savedForest struct {
+	Version     int
+	Config      savedConfig
+	Columns     []savedColumn
+	Label       savedColumn
+	Trees       []savedTree
+	Boost       *savedBoosting    `json:",omitempty"`
+	Calibration *savedCalibration `json:",omitempty"`
+	Outputs     []savedColumn     `json:",omitempty"`
+	Seed        int64             `json:",omitempty"`
+	Rows        int               `json:",omitempty"`
+}
+
+type savedConfig struct {
+	MaxDepth            int
+	SqrtCols            int
+	Categorical         []bool
+	Bootstrap           bool
+	MinSamplesSplit     int
+	MinSamplesLeaf      int
+	MinImpurityDecrease float64
+	MaxLeafNodes        int
+	CCPAlpha            float64
+	ClassCounts         []int  `json:",omitempty"`
+	WeightColumn        string `json:",omitempty"`
+	ClassWeight         string `json:",omitempty"`
+	ExtraTrees          bool
+	Regression          bool
+	KeepValues          bool
+	Monotone            []int `json:",omitempty"`
+}
+
+type savedBoosting struct {
+	Loss         string
+	LearningRate float64
+	Init         []float64
+	Outputs      []int
+}
+
+type savedCalibration struct {
+	Method  string
+	Classes []savedCalibrator
+}
+
+type savedCalibrator struct {
+	A float64   `json:",omitempty"`
+	B float64   `json:",omitempty"`
+	X []float64 `json:",omitempty"`
+	Y []float64 `json:",omitempty"`
+}
+
+type savedColumn struct {
+	Name        string
+	Categorical bool
+	Levels      []string `json:",omitempty"`
+}
+
+type savedTree struct {
+	MaxDepth int
+	Features []int
+	OOB      []int `json:",omitempty"`
+	Seed     int64 `json:",omitempty"`
+	Root     savedNode
+}
+
+type savedNode struct {
+	Leaf           bool
+	Class          float64
+	Samples        int
+	Weight         float64 `json:",omitempty"`
+	Impurity       float64
+	Distribution   map[string]float64 `json:",omitempty"`
+	Feature        int                `json:",omitempty"`
+	Threshold      float64            `json:",omitempty"`
+	Categorical    bool               `json:",omitempty"`
+	LeftCategories []float64          `json:",omitempty"`
+	Children       []savedNode        `json:",omitempty"`
+	Values         []float64          `json:",omitempty"`
+	ValueWeights   []float64          `json:",omitempty"`
+	Outputs        []float64          `json:",omitempty"`
+}
+
+// Function to keep a threshold finite, as json has no infinity
+func finite(val float64) float64 {
+	if math.IsInf(val, 1) {
+		return math.MaxFloat64
+	} else if math.IsInf(val, -1) {
+		return -math.MaxFloat64
+	}
+	return val
+}
+
+func saveColumn(c *Column) savedColumn {
+	return savedColumn{Name: c.name, Categorical: c.categorical, Levels: c.levels}
+}
+
+func loadColumn(s *savedColumn) Column {
+	c := Column{name: s.Name, categorical: s.Categorical}
+	if s.Categorical {
+		c.codes = make(map[string]int)
+		for _, level := range s.Levels {
+			c.encode(level)
+		}
+	}
+	return c
+}
+
+func saveNode(node *DNode) savedNode {
+	s := savedNode{
+		Leaf:     node.nodeType == "leaf",
+		Class:    node.predictedClass,
+		Samples:  node.nSamples,
+		Impurity: node.impurity,
+		Values:   node.values,
+		Outputs:  node.outputs,
+	}
+	if node.weight != float64(node.nSamples) {
+		s.Weight = node.weight
+	}
+	for _, w := range node.valueWeights {
+		if w != 1 {
+			s.ValueWeights = node.valueWeights
+			break
+		}
+	}
+	if len(node.distribution) > 0 {
+		s.Distribution = make(map[string]float64)
+		for class, cnt := range node.distribution {
+			s.Distribution[fmt.Sprint(class)] = cnt
+		}
+	}
+	if !s.Leaf && len(node.children) == 2 {
+		s.Feature = node.testAttribute
+		s.Threshold = finite(node.testValue)
+		if node.categorical {
+			s.Categorical = true
+			s.Threshold = 0
+			s.LeftCategories = node.step(true).categories
+		}
+		s.Children = []savedNode{saveNode(&node.children[0]), saveNode(&node.children[1])}
+	}
+	return s
+}
+
+func loadNode(s *savedNode) (DNode, error) {
+	node := DNode{predictedClass: s.Class, nSamples: s.Samples, weight: float64(s.Samples), impurity: s.Impurity, values: s.Values, valueWeights: s.ValueWeights, outputs: s.Outputs}
+	if s.Weight != 0 {
+		node.weight = s.Weight
+	}
+	if s.Values != nil && s.ValueWeights == nil {
+		node.valueWeights = weightsOf(nil, make([]int, len(s.Values)))
+	}
+	if s.Distribution != nil {
+		node.distribution = make(map[float64]float64)
+		for class, cnt := range s.Distribution {
+			var k float64
+			if _, err := fmt.Sscan(class, &k); err != nil {
+				return node, fmt.Errorf("bad class %q in distribution", class)
+			}
+			node.distribution[k] = cnt
+		}
+	}
+
+	// Models without the weight of the nodes weigh them by their classes
+	if s.Weight == 0 && s.Distribution != nil {
+		node.weight = 0
+		for _, cnt := range s.Distribution {
+			node.weight += cnt
+		}
+	}
+	if s.Leaf {
+		node.nodeType = "leaf"
+		return node, nil
+	}
+	if len(s.Children) != 2 {
+		return node, fmt.Errorf("split node with %d children", len(s.Children))
+	}
+	node.testAttribute, node.testValue = s.Feature, s.Threshold
+	if s.Categorical {
+		node.categorical = true
+		node.leftCategories = make(map[float64]bool)
+		for _, cat := range s.LeftCategories {
+			node.leftCategories[cat] = true
+		}
+	}
+	for k := range s.Children {
+		child, err := loadNode(&s.Children[k])
+		if err != nil {
+			return node, err
+		}
+		node.children = append(node.children, child)
+	}
+	return node, nil
+}
+
+// Save writes the forest to a json model file
+func (F *Forest) Save(path string) error {
+	s := savedForest{Version: modelVersion, Label: saveColumn(&F.label), Seed: F.seed, Rows: F.rows}
+	if F.config != nil {
+		s.Config = savedConfig{
+			MaxDepth:            F.config.maxDepth,
+			SqrtCols:            F.config.sqrtCols,
+			Categorical:         F.config.categorical,
+			Bootstrap:           F.config.bootstrap,
+			MinSamplesSplit:     F.config.minSamplesSplit,
+			MinSamplesLeaf:      F.config.minSamplesLeaf,
+			MinImpurityDecrease: F.config.minImpurityDecrease,
+			MaxLeafNodes:        F.config.maxLeafNodes,
+			CCPAlpha:            F.config.ccpAlpha,
+			ClassCounts:         F.config.classCounts,
+			WeightColumn:        F.config.weightColumn,
+			ClassWeight:         F.config.classWeight,
+			ExtraTrees:          F.config.extraTrees,
+			Regression:          F.config.regression,
+			KeepValues:          F.config.keepValues,
+			Monotone:            F.config.monotone,
+		}
+	}
+	for j := range F.columns {
+		s.Columns = append(s.Columns, saveColumn(&F.columns[j]))
+	}
+	for o := range F.outputs {
+		s.Outputs = append(s.Outputs, saveColumn(&F.outputs[o]))
+	}
+	for _, tree := range F.trees {
+		s.Trees = append(s.Trees, savedTree{MaxDepth: tree.maxDepth, Features: tree.features, OOB: tree.oob, Seed: tree.seed, Root: saveNode(&tree.root)})
+	}
+	if F.boost != nil {
+		s.Boost = &savedBoosting{Loss: F.boost.loss, LearningRate: F.boost.learningRate, Init: F.boost.init, Outputs: F.boost.outputs}
+	}
+	if F.calibration != nil {
+		s.Calibration = &savedCalibration{Method: F.calibration.method}
+		for _, c := range F.calibration.classes {
+			s.Calibration.Classes = append(s.Calibration.Classes, savedCalibrator{A: c.a, B: c.b, X: c.x, Y: c.y})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(&s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadForest reads a forest from a json model file written by Save
+func LoadForest(path string) (*Forest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s savedForest
+	if err := json.NewDecoder(f).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Version != modelVersion {
+		return nil, fmt.Errorf("%s: unsupported model version %d", path, s.Version)
+	}
+
+	F := &Forest{label: loadColumn(&s.Label), seed: s.Seed, rows: s.Rows}
+	F.config = &ForestConfig{
+		maxDepth:            s.Config.MaxDepth,
+		sqrtCols:            s.Config.SqrtCols,
+		categorical:         s.Config.Categorical,
+		bootstrap:           s.Config.Bootstrap,
+		minSamplesSplit:     s.Config.MinSamplesSplit,
+		minSamplesLeaf:      s.Config.MinSamplesLeaf,
+		minImpurityDecrease: s.Config.MinImpurityDecrease,
+		maxLeafNodes:        s.Config.MaxLeafNodes,
+		ccpAlpha:            s.Config.CCPAlpha,
+		classCounts:         s.Config.ClassCounts,
+		weightColumn:        s.Config.WeightColumn,
+		classWeight:         s.Config.ClassWeight,
+		extraTrees:          s.Config.ExtraTrees,
+		regression:          s.Config.Regression,
+		keepValues:          s.Config.KeepValues,
+		monotone:            s.Config.Monotone,
+	}
+	if s.Boost != nil {
+		if len(s.Boost.Outputs) != len(s.Trees) {
+			return nil, fmt.Errorf("%s: %d boosted outputs for %d trees", path, len(s.Boost.Outputs), len(s.Trees))
+		}
+		F.boost = &Boosting{loss: s.Boost.Loss, learningRate: s.Boost.LearningRate, init: s.Boost.Init, outputs: s.Boost.Outputs}
+	}
+	if s.Calibration != nil {
+		F.calibration = &Calibration{method: s.Calibration.Method}
+		for _, c := range s.Calibration.Classes {
+			if len(c.X) != len(c.Y) {
+				return nil, fmt.Errorf("%s: isotonic calibration with %d steps and %d values", path, len(c.X), len(c.Y))
+			}
+			F.calibration.classes = append(F.calibration.classes, calibrator{a: c.A, b: c.B, x: c.X, y: c.Y})
+		}
+	}
+	for j := range s.Columns {
+		F.columns = append(F.columns, loadColumn(&s.Columns[j]))
+	}
+	for o := range s.Outputs {
+		F.outputs = append(F.outputs, loadColumn(&s.Outputs[o]))
+	}
+	for t := range s.Trees {
+		root, err := loadNode(&s.Trees[t].Root)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tree %d: %w", path, t, err)
+		}
+		tree := F.config.newTree(s.Trees[t].Features, s.Trees[t].Seed)
+		tree.maxDepth, tree.oob, tree.root = s.Trees[t].MaxDepth, s.Trees[t].OOB, root
+		F.trees = append(F.trees, tree)
+	}
+	return F, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Function to save the forest to a temporary file and to load it back
+func saveLoad(t *testing.T, F *Forest) *Forest {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := F.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadForest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.trees) != len(F.trees) {
+		t.Fatalf("loaded %d trees, want %d", len(loaded.trees), len(F.trees))
+	}
+	if loaded.seed != F.seed || loaded.rows != F.rows {
+		t.Errorf("loaded the seed %d and %d rows, want %d and %d", loaded.seed, loaded.rows, F.seed, F.rows)
+	}
+	return loaded
+}
+
+func TestSaveLoadPredictions(t *testing.T) {
+	X, y, columns := testData(200, 3)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+	rows := allRows(X.Rows())
+
+	tests := []struct {
+		name   string
+		config ForestConfig
+		trees  int
+	}{
+		{name: "full trees", config: ForestConfig{maxDepth: 20}, trees: 3},
+		{name: "bootstrap", config: ForestConfig{maxDepth: 8, bootstrap: true, sqrtCols: 2}, trees: 10},
+		{name: "stopping rules", config: ForestConfig{maxDepth: 8, minSamplesLeaf: 5, maxLeafNodes: 10}, trees: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			F := testForest(X, y, columns, classes, &test.config, test.trees, 5)
+			loaded := saveLoad(t, F)
+			if got, want := loaded.predictions(X, rows), F.predictions(X, rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("the loaded forest predicts %v, want %v", got[:5], want[:5])
+			}
+			if got, want := loaded.voteFractions(X, rows), F.voteFractions(X, rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("the loaded forest gives the votes %v, want %v", got[:2], want[:2])
+			}
+		})
+	}
+}
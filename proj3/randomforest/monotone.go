@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// ParseMonotone returns the monotonic constraint of every column of the
+// data described by spec, a comma separated list of column:direction pairs.
+// The column is a name or an index, and the direction is 1 (or +) if the
+// prediction may only go up as the column grows and -1 (or -) if it may
+// only go down. The columns left out are free. Only numeric columns can be
+// constrained. An empty spec returns nil
+func ParseMonotone(spec string, columns []Column) ([]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	names := make([]string, len(columns))
+	for j := range columns {
+		names[j] = columns[j].name
+	}
+	monotone := make([]int, len(columns))
+	for _, part := range SplitList(spec) {
+		sep := strings.LastIndexByte(part, ':')
+		if sep < 0 {
+			return nil, fmt.Errorf("bad monotonic constraint %q, expected column:direction", part)
+		}
+		j, err := resolveColumn(strings.TrimSpace(part[:sep]), names)
+		if err != nil {
+			return nil, err
+		}
+		if columns[j].categorical {
+			return nil, fmt.Errorf("column %s is categorical and cannot be monotonic", columns[j].name)
+		}
+		switch strings.TrimSpace(part[sep+1:]) {
+		case "1", "+1", "+":
+			monotone[j] = 1
+		case "-1", "-":
+			monotone[j] = -1
+		case "0":
+			monotone[j] = 0
+		default:
+			return nil, fmt.Errorf("bad direction in %q, expected 1 or -1", part)
+		}
+	}
+	return monotone, nil
+}
+
+// Function to get the monotonic constraint of a column: 1 if the prediction
+// may only go up as the column grows, -1 if it may only go down, 0 if free
+func (T *Tree) direction(col int) int {
+	if col < len(T.monotone) {
+		return T.monotone[col]
+	}
+	return 0
+}
+
+// Function to bound the values of the nodes so that the predictions of the
+// tree respect its monotonic constraints. Going down from the root, the
+// children of a split on a constrained column are bounded on either side of
+// the middle of their two values, and every node is kept within the bounds
+// of its parent. Two rows differing only in a constrained column then reach
+// leaves on either side of the split on that column where they part
+func (T *Tree) boundValues() {
+	if T.monotone == nil {
+		return
+	}
+	T.boundNode(&T.root, math.Inf(-1), math.Inf(1))
+}
+
+// Helper function to boundValues
+func (T *Tree) boundNode(node *DNode, lower float64, upper float64) {
+	node.predictedClass = math.Min(math.Max(node.predictedClass, lower), upper)
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return
+	}
+	left, right := &node.children[0], &node.children[1]
+	d := T.direction(node.testAttribute)
+	if d == 0 || node.categorical {
+		T.boundNode(left, lower, upper)
+		T.boundNode(right, lower, upper)
+		return
+	}
+	mid := math.Min(math.Max((left.predictedClass+right.predictedClass)/2, lower), upper)
+	if d > 0 {
+		T.boundNode(left, lower, mid)
+		T.boundNode(right, mid, upper)
+	} else {
+		T.boundNode(left, mid, upper)
+		T.boundNode(right, lower, mid)
+	}
+}
+
+// The values of the columns of the rows reaching a leaf, from the splits
+// below some node: the interval [low, high) of every numeric column split
+// on, and the categories allowed of every categorical one
+type leafRegion struct {
+	value     float64
+	low, high map[int]float64
+	allowed   map[int][]bool
+}
+
+// Function to find the leaves below the node with the values of the
+// columns of the rows reaching them from the node. levels holds the number
+// of categories of every column
+func leafRegions(node *DNode, region leafRegion, levels []int, leaves []leafRegion) []leafRegion {
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		region.value = node.predictedClass
+		return append(leaves, region)
+	}
+	j := node.testAttribute
+	for k := range node.children {
+		child := leafRegion{low: region.low, high: region.high, allowed: region.allowed}
+		if node.categorical {
+			child.allowed = make(map[int][]bool, len(region.allowed)+1)
+			for c, cats := range region.allowed {
+				child.allowed[c] = cats
+			}
+			cats := make([]bool, levels[j])
+			for cat := range cats {
+				cats[cat] = node.leftCategories[float64(cat)] == (k == 0)
+				if region.allowed[j] != nil {
+					cats[cat] = cats[cat] && region.allowed[j][cat]
+				}
+			}
+			child.allowed[j] = cats
+		} else {
+			bounds := region.high
+			if k == 1 {
+				bounds = region.low
+			}
+			copied := make(map[int]float64, len(bounds)+1)
+			for c, v := range bounds {
+				copied[c] = v
+			}
+			copied[j] = node.testValue
+			if k == 0 {
+				child.high = copied
+			} else {
+				child.low = copied
+			}
+		}
+		leaves = leafRegions(&node.children[k], child, levels, leaves)
+	}
+	return leaves
+}
+
+// Function to check if rows differing only in column skip can reach both
+// leaves: their intervals overlap in every other numeric column and they
+// share a category in every other categorical column
+func (a *leafRegion) overlaps(b *leafRegion, skip int) bool {
+	get := func(m map[int]float64, j int, missing float64) float64 {
+		if v, ok := m[j]; ok {
+			return v
+		}
+		return missing
+	}
+	for _, m := range []map[int]float64{a.low, a.high, b.low, b.high} {
+		for j := range m {
+			if j == skip {
+				continue
+			}
+			low := math.Max(get(a.low, j, math.Inf(-1)), get(b.low, j, math.Inf(-1)))
+			high := math.Min(get(a.high, j, math.Inf(1)), get(b.high, j, math.Inf(1)))
+			if low >= high {
+				return false
+			}
+		}
+	}
+	for _, m := range []map[int][]bool{a.allowed, b.allowed} {
+		for j := range m {
+			if j == skip {
+				continue
+			}
+			shared := false
+			for cat := range m[j] {
+				if (a.allowed[j] == nil || a.allowed[j][cat]) && (b.allowed[j] == nil || b.allowed[j][cat]) {
+					shared = true
+					break
+				}
+			}
+			if !shared {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// A pair of leaves of a tree breaking a monotonic constraint: rows that
+// differ only in the column, split at threshold, reach the leaf predicting
+// below with the smaller value of the column and the leaf predicting above
+// with the larger one
+type MonotoneViolation struct {
+	tree      int
+	feature   int
+	threshold float64
+	below     float64
+	above     float64
+}
+
+// CheckMonotone checks that the predictions of the forest respect the
+// monotonic constraint of every column, 1 for a prediction that may only go
+// up as the column grows and -1 for one that may only go down. Every tree
+// is checked on its own, which is enough as the forest averages or adds up
+// their values. At every split on a constrained column, each leaf below the
+// smaller side is compared with each leaf below the larger side that rows
+// differing only in that column can reach. The violations are returned
+func (F *Forest) CheckMonotone(monotone []int) ([]MonotoneViolation, error) {
+	if !F.isRegression() && (F.boost == nil || F.boost.loss != "logistic") {
+		return nil, errors.New("only regression forests, boosted trees with the squared loss and boosted trees of two classes have monotone predictions")
+	}
+	if len(monotone) != len(F.columns) {
+		return nil, fmt.Errorf("%d monotonic constraints for %d columns", len(monotone), len(F.columns))
+	}
+	levels := make([]int, len(F.columns))
+	for j := range F.columns {
+		levels[j] = len(F.columns[j].levels)
+	}
+
+	var violations []MonotoneViolation
+	for t, tree := range F.trees {
+		var walk func(node *DNode)
+		walk = func(node *DNode) {
+			if node.nodeType == "leaf" || len(node.children) != 2 {
+				return
+			}
+			j := node.testAttribute
+			if d := monotone[j]; d != 0 && !node.categorical {
+				lower := leafRegions(&node.children[0], leafRegion{}, levels, nil)
+				upper := leafRegions(&node.children[1], leafRegion{}, levels, nil)
+				for a := range lower {
+					for b := range upper {
+						gap := float64(d) * (upper[b].value - lower[a].value)
+						if gap < -1e-12*math.Max(1, math.Abs(lower[a].value)) && lower[a].overlaps(&upper[b], j) {
+							violations = append(violations, MonotoneViolation{tree: t, feature: j, threshold: node.testValue, below: lower[a].value, above: upper[b].value})
+						}
+					}
+				}
+			}
+			walk(&node.children[0])
+			walk(&node.children[1])
+		}
+		walk(&tree.root)
+	}
+	return violations, nil
+}
+
+// Function to print the first top violations of the monotonic constraints
+func PrintMonotoneViolations(violations []MonotoneViolation, columns []Column, top int) {
+	fmt.Printf("%-6s %-20s %14s %14s %14s\n", "tree", "feature", "threshold", "below", "above")
+	for k, v := range violations {
+		if k == top {
+			fmt.Printf("... %d more\n", len(violations)-top)
+			break
+		}
+		fmt.Printf("%-6d %-20s %14.6g %14.6g %14.6g\n", v.tree, columns[v.feature].name, v.threshold, v.below, v.above)
+	}
+}
+
+// Function to run the monotone subcommand: monotone -model file [-monotone list] [-top n].
+// The constraints the model was trained with are checked unless others are
+// given, and the exit status is 1 if any is broken
+func runMonotone(args []string) {
+	fs := flag.NewFlagSet("monotone", flag.ExitOnError)
+	modelPath := fs.String("model", "", "the saved model to read")
+	spec := fs.String("monotone", "", "comma separated column:direction pairs, those of the model if empty")
+	top := fs.Int("top", 5, "number of violations printed")
+	fs.Parse(args)
+
+	if *modelPath == "" {
+		log.Fatal("monotone needs -model")
+	}
+	forest, err := LoadForest(*modelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	monotone := forest.config.monotone
+	if *spec != "" {
+		if monotone, err = ParseMonotone(*spec, forest.columns); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if monotone == nil {
+		log.Fatal("the model has no monotonic constraints, give them with -monotone")
+	}
+
+	violations, err := forest.CheckMonotone(monotone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var constrained []string
+	for j, d := range monotone {
+		if d > 0 {
+			constrained = append(constrained, forest.columns[j].name+" increasing")
+		} else if d < 0 {
+			constrained = append(constrained, forest.columns[j].name+" decreasing")
+		}
+	}
+	fmt.Printf("Constraints: %s\n", strings.Join(constrained, ", "))
+	if len(violations) == 0 {
+		fmt.Printf("The %d trees respect the monotonic constraints\n", len(forest.trees))
+		return
+	}
+	PrintMonotoneViolations(violations, forest.columns, *top)
+	fmt.Printf("%d violations of the monotonic constraints\n", len(violations))
+	os.Exit(1)
+}
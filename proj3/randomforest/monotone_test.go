@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckMonotone(t *testing.T) {
+	X, y, columns := testData(300, 11)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+	yReg, target := testRegressionLabel(X)
+	yBinary, binary := testBinaryLabel(y)
+
+	// The label goes up and down with x1 through its sine, so only trees
+	// constrained to grow with x1 respect the constraint
+	increasing := []int{0, 1, 0}
+	tests := []struct {
+		name       string
+		forest     func() *Forest
+		monotone   []int
+		violations bool
+		err        bool
+	}{
+		{
+			name: "unconstrained regression",
+			forest: func() *Forest {
+				return testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 10, bootstrap: true, regression: true}, 10, 3)
+			},
+			monotone:   increasing,
+			violations: true,
+		},
+		{
+			name: "constrained regression",
+			forest: func() *Forest {
+				return testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 10, bootstrap: true, regression: true, monotone: increasing}, 10, 3)
+			},
+			monotone: increasing,
+		},
+		{
+			name: "constrained extra trees",
+			forest: func() *Forest {
+				return testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 10, extraTrees: true, regression: true, monotone: increasing}, 10, 3)
+			},
+			monotone: increasing,
+		},
+		{
+			name:       "unconstrained squared loss",
+			forest:     func() *Forest { return testBoost(t, X, yReg, columns, target, "squared", nil, 3) },
+			monotone:   increasing,
+			violations: true,
+		},
+		{
+			name:     "constrained squared loss",
+			forest:   func() *Forest { return testBoost(t, X, yReg, columns, target, "squared", increasing, 3) },
+			monotone: increasing,
+		},
+		{
+			name:     "constrained logistic loss",
+			forest:   func() *Forest { return testBoost(t, X, yBinary, columns, binary, "log", []int{-1, 0, 0}, 3) },
+			monotone: []int{-1, 0, 0},
+		},
+		{
+			name: "classification",
+			forest: func() *Forest {
+				return testForest(X, y, columns, classes, &ForestConfig{maxDepth: 10}, 3, 3)
+			},
+			monotone: increasing,
+			err:      true,
+		},
+		{
+			name: "wrong number of constraints",
+			forest: func() *Forest {
+				return testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 10, regression: true}, 3, 3)
+			},
+			monotone: []int{0, 1},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations, err := test.forest().CheckMonotone(test.monotone)
+			if test.err {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.violations && len(violations) == 0 {
+				t.Error("got no violations of the monotonic constraints")
+			}
+			if !test.violations && len(violations) > 0 {
+				t.Errorf("got %d violations of the monotonic constraints, the first %+v", len(violations), violations[0])
+			}
+		})
+	}
+}
+
+func TestMonotoneSaveLoad(t *testing.T) {
+	X, _, columns := testData(200, 3)
+	yReg, target := testRegressionLabel(X)
+	rows := allRows(X.Rows())
+
+	F := testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 6, regression: true, monotone: []int{1, 0, 0}}, 5, 5)
+	loaded := saveLoad(t, F)
+	if !reflect.DeepEqual(loaded.config.monotone, F.config.monotone) {
+		t.Errorf("loaded the constraints %v, want %v", loaded.config.monotone, F.config.monotone)
+	}
+	if got, want := loaded.predictions(X, rows), F.predictions(X, rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("the loaded forest predicts %v, want %v", got[:5], want[:5])
+	}
+}
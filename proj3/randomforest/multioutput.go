@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"proj3/concurrent"
+	"sort"
+	"strconv"
+)
+
+// The layout of the statistics of the rows of a node for every output of a
+// multi-output tree, stored one after the other in a single slice: the
+// weight of each class of a classification output, or the weighted sum and
+// sum of squares of the values of a regression output
+type outputLayout struct {
+	regression bool
+	classes    []int
+	offsets    []int
+	size       int
+}
+
+// Function to lay out the statistics of the outputs Y of the rows idx
+func newOutputLayout(Y [][]float64, idx []int, regression bool) *outputLayout {
+	L := &outputLayout{regression: regression}
+	for _, y := range Y {
+		k := 2
+		if !regression {
+			k = 1
+			for _, i := range idx {
+				if int(y[i])+1 > k {
+					k = int(y[i]) + 1
+				}
+			}
+		}
+		L.classes = append(L.classes, k)
+		L.offsets = append(L.offsets, L.size)
+		L.size += k
+	}
+	return L
+}
+
+// Function to add row i of weight w to the statistics, or to take it away
+// with a negative weight
+func (L *outputLayout) add(stats []float64, Y [][]float64, i int, w float64) {
+	for o, y := range Y {
+		if L.regression {
+			stats[L.offsets[o]] += w * y[i]
+			stats[L.offsets[o]+1] += w * y[i] * y[i]
+		} else {
+			stats[L.offsets[o]+int(y[i])] += w
+		}
+	}
+}
+
+// Function to find the class of output o with the largest weight in the
+// statistics
+func (L *outputLayout) mostFrequent(stats []float64, o int) int {
+	best := 0
+	for c := 1; c < L.classes[o]; c++ {
+		if stats[L.offsets[o]+c] > stats[L.offsets[o]+best] {
+			best = c
+		}
+	}
+	return best
+}
+
+// Function to find the impurity of rows of total weight w from their
+// statistics: the entropy of the classes, or the variance of the values, of
+// every output summed over the outputs
+func (L *outputLayout) impurity(stats []float64, w float64) float64 {
+	if w <= 0 {
+		return 0
+	}
+	total := 0.0
+	for o, off := range L.offsets {
+		if L.regression {
+			mean := stats[off] / w
+			if v := stats[off+1]/w - mean*mean; v > 0 {
+				total += v
+			}
+			continue
+		}
+		total += classEntropy(stats[off : off+L.classes[o]])
+	}
+	return total
+}
+
+// Function to fit the tree on the rows idx of the data, predicting every
+// output of Y at once
+func (T *Tree) fitOutputs(X Matrix, Y [][]float64, idx []int) {
+	T.wTotal = sum(T.rowWeights(idx))
+	T.root = T.outputsBuildTree(X, Y, newOutputLayout(Y, idx, T.regression), idx, 0)
+}
+
+// Function to create a leaf node for the rows idx of the data, predicting
+// the class with the largest weight or the weighted mean of every output
+func (T *Tree) outputsLeaf(Y [][]float64, L *outputLayout, idx []int) DNode {
+	node := DNode{nodeType: "leaf"}
+	if len(idx) == 0 {
+		node.predictedClass = -0.123
+		return node
+	}
+	w := T.rowWeights(idx)
+	node.nSamples, node.weight = len(idx), sum(w)
+	stats := make([]float64, L.size)
+	for k, i := range idx {
+		L.add(stats, Y, i, w[k])
+	}
+	node.impurity = L.impurity(stats, node.weight)
+	for _, y := range Y {
+		if T.regression {
+			node.outputs = append(node.outputs, weightedMean(pick(y, idx), w))
+		} else {
+			node.outputs = append(node.outputs, weightedMostFrequent(pick(y, idx), w))
+		}
+	}
+	node.predictedClass = node.outputs[0]
+	return node
+}
+
+// Method of class Tree to build a multi-output decision tree
+func (T *Tree) outputsBuildTree(X Matrix, Y [][]float64, L *outputLayout, idx []int, currDepth int) DNode {
+	node := T.outputsLeaf(Y, L, idx)
+	rows := len(idx)
+	if rows == 0 || currDepth == T.maxDepth || node.impurity <= 0 || rows < T.minSamplesSplit || rows < 2*T.minSamplesLeaf || T.allSame(X, idx) {
+		return node
+	}
+
+	A, val, leftSet, minImpurity := T.outputsSplit(X, Y, L, idx)
+	if math.IsInf(minImpurity, 1) {
+		return node
+	}
+	if node.weight/T.wTotal*(node.impurity-minImpurity) < T.minImpurityDecrease {
+		return node
+	}
+	node.setSplit(&splitCandidate{attribute: A, value: val, leftSet: leftSet})
+
+	left, right := node.partition(X, idx)
+	for _, part := range [][]int{left, right} {
+		child := T.outputsBuildTree(X, Y, L, part, currDepth+1)
+
+		// A child without rows predicts what its parent does
+		if len(part) == 0 {
+			child.predictedClass = node.predictedClass
+			child.outputs = append([]float64(nil), node.outputs...)
+		}
+		node.children = append(node.children, child)
+	}
+	return node
+}
+
+// Function to find the split of the rows idx of the data with the smallest
+// impurity summed over the outputs. Numeric columns are split between
+// consecutive values. The categories of categorical columns are sorted as
+// in importanceCat and importanceCatReg once for every output, by the rate
+// of the most frequent class of the output in the node or by the mean of
+// its values, and split between two sorted categories. The impurity is
+// infinite if no split leaves enough rows in both children
+func (T *Tree) outputsSplit(X Matrix, Y [][]float64, L *outputLayout, idx []int) (int, float64, map[float64]bool, float64) {
+	w := T.rowWeights(idx)
+	total := make([]float64, L.size)
+	for k, i := range idx {
+		L.add(total, Y, i, w[k])
+	}
+	wTotal := sum(w)
+	none := math.Inf(1)
+	best, bestA, bestVal := none, -1, 0.0
+	var bestSet map[float64]bool
+
+	right := make([]float64, L.size)
+	score := func(left []float64, wLeft float64, nLeft int) float64 {
+		if nLeft < T.minSamplesLeaf || len(idx)-nLeft < T.minSamplesLeaf || wLeft <= 0 || wLeft >= wTotal {
+			return none
+		}
+		for k := range right {
+			right[k] = total[k] - left[k]
+		}
+		return wLeft/wTotal*L.impurity(left, wLeft) + (wTotal-wLeft)/wTotal*L.impurity(right, wTotal-wLeft)
+	}
+
+	for _, j := range T.features {
+		values := column(X, idx, j)
+
+		if T.isCategorical(j) {
+			stats := make(map[float64][]float64)
+			weight := make(map[float64]float64)
+			count := make(map[float64]int)
+			var cats []float64
+			for k, i := range idx {
+				v := values[k]
+				if stats[v] == nil {
+					stats[v] = make([]float64, L.size)
+					cats = append(cats, v)
+				}
+				L.add(stats[v], Y, i, w[k])
+				weight[v] += w[k]
+				count[v]++
+			}
+			if len(cats) < 2 {
+				continue
+			}
+			for o, off := range L.offsets {
+				key := off
+				if !L.regression {
+					key += L.mostFrequent(total, o)
+				}
+				sortCategories(cats, func(cat float64) float64 { return stats[cat][key] / weight[cat] })
+
+				left := make([]float64, L.size)
+				wLeft, nLeft := 0.0, 0
+				for n, c := range cats[:len(cats)-1] {
+					for s := range left {
+						left[s] += stats[c][s]
+					}
+					wLeft += weight[c]
+					nLeft += count[c]
+					if s := score(left, wLeft, nLeft); s < best {
+						best, bestA, bestVal = s, j, 0
+						bestSet = make(map[float64]bool)
+						for _, cat := range cats[:n+1] {
+							bestSet[cat] = true
+						}
+					}
+				}
+			}
+			continue
+		}
+
+		order := make([]int, len(idx))
+		for k := range order {
+			order[k] = k
+		}
+		sort.Slice(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+		left := make([]float64, L.size)
+		wLeft := 0.0
+		for n, k := range order[:len(order)-1] {
+			L.add(left, Y, idx[k], w[k])
+			wLeft += w[k]
+			next := values[order[n+1]]
+			if values[k] == next {
+				continue
+			}
+			if s := score(left, wLeft, n+1); s < best {
+				best, bestA, bestVal, bestSet = s, j, (values[k]+next)/2, nil
+			}
+		}
+	}
+	if bestA < 0 {
+		return T.features[0], 0, nil, none
+	}
+	return bestA, bestVal, bestSet, best
+}
+
+// Function to predict every output of the rows idx of the data
+func (T *Tree) predictOutputs(X Matrix, idx []int) [][]float64 {
+	pred := make([][]float64, len(idx))
+	for k, i := range idx {
+		pred[k] = T.leafOf(X, i).outputs
+	}
+	return pred
+}
+
+// Creating a callable growing one tree of a multi-output forest
+type OutputsTask struct {
+	X      Matrix
+	Y      [][]float64
+	train  []int
+	config *ForestConfig
+	seed   int64
+}
+
+// Defining the Call function for the Executor. The tree is grown like the
+// trees of calculateIntervals, on all the outputs at once
+func (task *OutputsTask) Call() interface{} {
+	rng := rand.New(rand.NewSource(task.seed))
+	tree := task.config.newTree(task.config.pickColumns(rng, task.X.Cols()), task.seed)
+	tree.rng = rng
+	if task.config.bootstrap {
+		var sample []int
+		sample, tree.oob = bootstrapSample(task.train, rng)
+		tree.fitOutputs(task.X, task.Y, sample)
+	} else {
+		tree.fitOutputs(task.X, task.Y, task.train)
+	}
+	return tree
+}
+
+// MultiOutputFit trains a forest of the given number of trees predicting
+// every output of Y, classes or values with config.regression, from the
+// same features. Every tree splits on the impurity summed over the outputs
+// and its leaves hold one prediction per output. The trees are grown on the
+// executor with the seeds derived from seed
+func MultiOutputFit(executor concurrent.ExecutorService, X Matrix, Y [][]float64, train []int, config *ForestConfig, trees int, seed int64) []*Tree {
+	var tasks []concurrent.Callable
+	for k := 0; k < trees; k++ {
+		tasks = append(tasks, &OutputsTask{X: X, Y: Y, train: train, config: config, seed: treeSeed(seed, k)})
+	}
+	var forest []*Tree
+	for _, result := range runTasks(executor, tasks) {
+		forest = append(forest, result.(*Tree))
+	}
+	return forest
+}
+
+// Function to find the predictions of the forest for every output of the
+// rows idx of the data: the class with the most votes or the mean of the
+// values of the trees. The predictions are returned output by output
+func (F *Forest) predictOutputs(X Matrix, idx []int) [][]float64 {
+	perTree := make([][][]float64, len(F.trees))
+	for t, tree := range F.trees {
+		perTree[t] = tree.predictOutputs(X, idx)
+	}
+	pred := make([][]float64, len(F.outputs))
+	for o := range pred {
+		pred[o] = make([]float64, len(idx))
+		for k := range idx {
+			votes := make([]float64, 0, len(F.trees))
+			for t := range F.trees {
+				votes = append(votes, perTree[t][k][o])
+			}
+			if F.isRegression() {
+				pred[o][k] = sum(votes) / float64(len(votes))
+			} else {
+				pred[o][k] = mostFrequent(votes)
+			}
+		}
+	}
+	return pred
+}
+
+// Function to print the accuracy of every output on the rows idx of the
+// data, or its RMSE and R2 for a regression forest
+func (F *Forest) PrintOutputScores(X Matrix, Y [][]float64, idx []int) [][]float64 {
+	pred := F.predictOutputs(X, idx)
+	if F.isRegression() {
+		fmt.Printf("%-20s %12s %12s\n", "output", "rmse", "r2")
+	} else {
+		fmt.Printf("%-20s %12s\n", "output", "accuracy")
+	}
+	for o, col := range F.outputs {
+		yTrue := pick(Y[o], idx)
+		if F.isRegression() {
+			rmse, r2 := RegressionScores(pred[o], yTrue)
+			fmt.Printf("%-20s %12.4f %12.4f\n", col.name, rmse, r2)
+			continue
+		}
+		acc := 0
+		for k := range yTrue {
+			if pred[o][k] == yTrue[k] {
+				acc++
+			}
+		}
+		fmt.Printf("%-20s %12.4f\n", col.name, float64(acc)/float64(len(yTrue)))
+	}
+	return pred
+}
+
+// Function to print the out-of-bag accuracy of every output, or its R2 for
+// a regression forest: every row is predicted only by the trees that did not
+// see it during training
+func (F *Forest) PrintOOBOutputScores(X Matrix, Y [][]float64) []float64 {
+	votes := make(map[int][][]float64)
+	for _, tree := range F.trees {
+		for k, pred := range tree.predictOutputs(X, tree.oob) {
+			votes[tree.oob[k]] = append(votes[tree.oob[k]], pred)
+		}
+	}
+	var rows []int
+	for i := range votes {
+		rows = append(rows, i)
+	}
+	sort.Ints(rows)
+
+	if F.isRegression() {
+		fmt.Printf("%-20s %12s\n", "output", "oob r2")
+	} else {
+		fmt.Printf("%-20s %12s\n", "output", "oob accuracy")
+	}
+	scores := make([]float64, len(F.outputs))
+	for o, col := range F.outputs {
+		yPred := make([]float64, len(rows))
+		for k, i := range rows {
+			values := make([]float64, len(votes[i]))
+			for t, pred := range votes[i] {
+				values[t] = pred[o]
+			}
+			if F.isRegression() {
+				yPred[k] = sum(values) / float64(len(values))
+			} else {
+				yPred[k] = mostFrequent(values)
+			}
+		}
+		yTrue := pick(Y[o], rows)
+		if F.isRegression() {
+			_, scores[o] = RegressionScores(yPred, yTrue)
+		} else if len(rows) > 0 {
+			acc := 0
+			for k := range yTrue {
+				if yPred[k] == yTrue[k] {
+					acc++
+				}
+			}
+			scores[o] = float64(acc) / float64(len(rows))
+		}
+		fmt.Printf("%-20s %12.4f\n", col.name, scores[o])
+	}
+	return scores
+}
+
+// Function to write the actual and predicted value of every output of the
+// rows idx of the data to a csv, with the classes as their labels
+func (F *Forest) WriteOutputPredictions(path string, Y [][]float64, idx []int, pred [][]float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	var header []string
+	for _, col := range F.outputs {
+		header = append(header, "actual_"+col.name, "predicted_"+col.name)
+	}
+	w.Write(header)
+	format := func(col *Column, v float64) string {
+		if F.isRegression() {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return col.level(v)
+	}
+	for k, i := range idx {
+		var record []string
+		for o := range F.outputs {
+			record = append(record, format(&F.outputs[o], Y[o][i]), format(&F.outputs[o], pred[o][k]))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Test made at one node of a decision path and the way the row went
+type PathStep struct {
+	feature    int
+	threshold  float64
+	categories []float64
+	left       bool
+}
+
+// Decision path of a row through one tree, ending at the leaf it reached
+type DecisionPath struct {
+	tree       int
+	steps      []PathStep
+	leaf       *DNode
+	regression bool
+}
+
+// Function to get the test of a split node as the step to one of its children
+func (node *DNode) step(left bool) PathStep {
+	step := PathStep{feature: node.testAttribute, threshold: node.testValue, left: left}
+	if node.categorical {
+		for cat := range node.leftCategories {
+			step.categories = append(step.categories, cat)
+		}
+		sort.Float64s(step.categories)
+	}
+	return step
+}
+
+// Function to follow row i of the data from the root of the tree to a leaf
+func (T *Tree) decisionPath(X Matrix, i int) DecisionPath {
+	var path DecisionPath
+	thisNode := &T.root
+	for thisNode.nodeType != "leaf" && len(thisNode.children) == 2 {
+		step := thisNode.step(thisNode.goesLeft(X, i))
+		path.steps = append(path.steps, step)
+		if step.left {
+			thisNode = &thisNode.children[0]
+		} else {
+			thisNode = &thisNode.children[1]
+		}
+	}
+	path.leaf, path.regression = thisNode, T.regression
+	return path
+}
+
+// DecisionPaths returns the path of row i of the data through every tree
+func (F *Forest) DecisionPaths(X Matrix, i int) []DecisionPath {
+	var paths []DecisionPath
+	for t, tree := range F.trees {
+		path := tree.decisionPath(X, i)
+		path.tree = t
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Function to write the test of a step as a rule that holds for the row
+func (step *PathStep) rule(columns []Column) string {
+	col := &columns[step.feature]
+	if step.categories != nil {
+		var cats []string
+		for _, cat := range step.categories {
+			cats = append(cats, col.level(cat))
+		}
+		op := "in"
+		if !step.left {
+			op = "not in"
+		}
+		return fmt.Sprintf("%s %s {%s}", col.name, op, strings.Join(cats, ", "))
+	}
+	op := "<"
+	if !step.left {
+		op = ">="
+	}
+	return fmt.Sprintf("%s %s %.6g", col.name, op, step.threshold)
+}
+
+// Function to write the class counts of the training rows of a node
+func distributionString(node *DNode, label Column) string {
+	var classes []float64
+	for class := range node.distribution {
+		classes = append(classes, class)
+	}
+	sort.Float64s(classes)
+	var parts []string
+	for _, class := range classes {
+		parts = append(parts, fmt.Sprintf("%s=%g", label.level(class), node.distribution[class]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Function to print the rules each tree applied to row i of the data and
+// the leaf it reached with the classes of the training rows in that leaf
+func PrintDecisionPaths(paths []DecisionPath, X Matrix, i int, columns []Column, label Column) {
+	fmt.Printf("row %d:\n", i)
+	for _, path := range paths {
+		var rules []string
+		for _, step := range path.steps {
+			rules = append(rules, step.rule(columns))
+		}
+		if len(rules) == 0 {
+			rules = append(rules, "(root)")
+		}
+		fmt.Printf("  tree %d: %s\n", path.tree, strings.Join(rules, " AND "))
+		if path.regression {
+			fmt.Printf("    -> value %.6g, %d training rows\n", path.leaf.predictedClass, path.leaf.nSamples)
+			continue
+		}
+		fmt.Printf("    -> class %s, %d training rows [%s]\n", label.level(path.leaf.predictedClass), path.leaf.nSamples, distributionString(path.leaf, label))
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"proj3/concurrent"
+	"sort"
+	"strconv"
+)
+
+// The leaf of a tree every row reaches and the rows reaching every leaf
+type leafGroups struct {
+	leaf []*DNode
+	rows map[*DNode][]int
+}
+
+// Creating a callable finding the leaves of the rows in a share of the trees
+type LeafGroupTask struct {
+	trees []*Tree
+	X     Matrix
+	idx   []int
+}
+
+// Defining the Call function for the Executor
+func (task *LeafGroupTask) Call() interface{} {
+	var groups []leafGroups
+	for _, tree := range task.trees {
+		g := leafGroups{leaf: make([]*DNode, len(task.idx)), rows: make(map[*DNode][]int)}
+		for a, i := range task.idx {
+			leaf := tree.leafOf(task.X, i)
+			g.leaf[a] = leaf
+			g.rows[leaf] = append(g.rows[leaf], a)
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// Creating a callable filling the proximities of the rows start to end-1,
+// which no other task writes to
+type ProximityTask struct {
+	groups     []leafGroups
+	prox       [][]float64
+	start, end int
+}
+
+// Defining the Call function for the Executor
+func (task *ProximityTask) Call() interface{} {
+	share := 1 / float64(len(task.groups))
+	for _, g := range task.groups {
+		for a := task.start; a < task.end; a++ {
+			for _, b := range g.rows[g.leaf[a]] {
+				task.prox[a][b] += share
+			}
+		}
+	}
+	return nil
+}
+
+// Function to split n items into at most chunks ranges of the same size
+func chunkRanges(n int, chunks int) [][2]int {
+	if chunks < 1 {
+		chunks = 1
+	}
+	size := (n + chunks - 1) / chunks
+	var ranges [][2]int
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+// Proximities returns the proximity of every pair of the rows idx of the
+// data: the fraction of the trees of the forest in which both rows land in
+// the same leaf. The leaves of the rows are found for chunks of the trees
+// on the executor, then the proximities are filled for chunks of the rows,
+// every task writing its own rows of the result
+func (F *Forest) Proximities(executor concurrent.ExecutorService, X Matrix, idx []int, chunks int) [][]float64 {
+	var tasks []concurrent.Callable
+	for _, r := range chunkRanges(len(F.trees), chunks) {
+		tasks = append(tasks, &LeafGroupTask{trees: F.trees[r[0]:r[1]], X: X, idx: idx})
+	}
+	var groups []leafGroups
+	for _, result := range runTasks(executor, tasks) {
+		groups = append(groups, result.([]leafGroups)...)
+	}
+
+	n := len(idx)
+	prox := make([][]float64, n)
+	for a := range prox {
+		prox[a] = make([]float64, n)
+	}
+	if len(groups) == 0 {
+		return prox
+	}
+	tasks = nil
+	for _, r := range chunkRanges(n, chunks) {
+		tasks = append(tasks, &ProximityTask{groups: groups, prox: prox, start: r[0], end: r[1]})
+	}
+	runTasks(executor, tasks)
+	return prox
+}
+
+// Function to find the median of the values
+func median(arr []float64) float64 {
+	if len(arr) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), arr...)
+	sort.Float64s(sorted)
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+	return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+}
+
+// OutlierMeasure returns Breiman's outlier measure of the rows idx of the
+// data from their proximities: the number of rows over the sum of the
+// squared proximities of the row to the other rows of its class, centred on
+// the median of the class and divided by the median absolute deviation of
+// the class. Rows with a measure above 10 are usually taken as outliers
+func OutlierMeasure(prox [][]float64, y []float64, idx []int) []float64 {
+	n := float64(len(idx))
+	raw := make([]float64, len(idx))
+	byClass := make(map[float64][]int)
+	for a, i := range idx {
+		byClass[y[i]] = append(byClass[y[i]], a)
+		total := 0.0
+		for b, k := range idx {
+			if b != a && y[k] == y[i] {
+				total += prox[a][b] * prox[a][b]
+			}
+		}
+		raw[a] = n
+		if total > 0 {
+			raw[a] = n / total
+		}
+	}
+
+	measure := make([]float64, len(idx))
+	for _, rows := range byClass {
+		values := make([]float64, len(rows))
+		for k, a := range rows {
+			values[k] = raw[a]
+		}
+		med := median(values)
+		for k := range values {
+			values[k] = math.Abs(values[k] - med)
+		}
+		mad := median(values)
+		for _, a := range rows {
+			measure[a] = raw[a] - med
+			if mad > 0 {
+				measure[a] /= mad
+			}
+		}
+	}
+	return measure
+}
+
+// MDS returns the classical multidimensional scaling of the rows in dims
+// dimensions, with 1 minus their proximity as the distance between them.
+// The largest eigenvectors of the double centred squared distances are
+// found by power iteration, one after the other, from random vectors drawn
+// from the seed
+func MDS(prox [][]float64, dims int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	n := len(prox)
+	B := make([][]float64, n)
+	rowMean := make([]float64, n)
+	allMean := 0.0
+	for a := range B {
+		B[a] = make([]float64, n)
+		for b := range B[a] {
+			d := 1 - prox[a][b]
+			B[a][b] = d * d
+			rowMean[a] += d * d / float64(n)
+		}
+		allMean += rowMean[a] / float64(n)
+	}
+	for a := range B {
+		for b := range B[a] {
+			B[a][b] = -0.5 * (B[a][b] - rowMean[a] - rowMean[b] + allMean)
+		}
+	}
+
+	coords := make([][]float64, n)
+	for a := range coords {
+		coords[a] = make([]float64, dims)
+	}
+	for d := 0; d < dims && d < n; d++ {
+		v := make([]float64, n)
+		for a := range v {
+			v[a] = rng.Float64() - 0.5
+		}
+		lambda := 0.0
+		for iter := 0; iter < 1000; iter++ {
+			next := make([]float64, n)
+			for a := range B {
+				for b, val := range B[a] {
+					next[a] += val * v[b]
+				}
+			}
+			norm := 0.0
+			for _, val := range next {
+				norm += val * val
+			}
+			norm = math.Sqrt(norm)
+			if norm == 0 {
+				break
+			}
+			change, dot := 0.0, 0.0
+			for a := range next {
+				next[a] /= norm
+				change += math.Abs(next[a] - v[a])
+				dot += next[a] * v[a]
+			}
+
+			// The Rayleigh quotient of v gives the sign of the eigenvalue
+			v, lambda = next, norm*dot
+			if change < 1e-9 {
+				break
+			}
+		}
+		if lambda <= 0 {
+			break
+		}
+
+		// Removing the eigenvector from B to find the next one
+		for a := range B {
+			coords[a][d] = v[a] * math.Sqrt(lambda)
+			for b := range B[a] {
+				B[a][b] -= lambda * v[a] * v[b]
+			}
+		}
+	}
+	return coords
+}
+
+// Function to print the rows with the largest outlier measure
+func PrintOutliers(measure []float64, idx []int, y []float64, label Column, top int) {
+	order := make([]int, len(idx))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool { return measure[order[a]] > measure[order[b]] })
+	if top < 0 || top > len(order) {
+		top = len(order)
+	}
+	fmt.Printf("%-8s %-20s %10s\n", "row", "class", "outlier")
+	for _, k := range order[:top] {
+		fmt.Printf("%-8d %-20s %10.3f\n", idx[k], label.level(y[idx[k]]), measure[k])
+	}
+}
+
+// Function to write the MDS coordinates of the rows to a csv, with their
+// class and outlier measure
+func WriteMDS(path string, coords [][]float64, measure []float64, idx []int, y []float64, label Column) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"row", "class", "outlier"}
+	if len(coords) > 0 {
+		for d := range coords[0] {
+			header = append(header, fmt.Sprintf("dim%d", d+1))
+		}
+	}
+	w.Write(header)
+	for k, i := range idx {
+		record := []string{strconv.Itoa(i), label.level(y[i]), strconv.FormatFloat(measure[k], 'g', 6, 64)}
+		for _, v := range coords[k] {
+			record = append(record, strconv.FormatFloat(v, 'g', 6, 64))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Function to write the proximity matrix of the rows to a csv, with the
+// rows of the data as the header
+func WriteProximities(path string, prox [][]float64, idx []int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"row"}
+	for _, i := range idx {
+		header = append(header, strconv.Itoa(i))
+	}
+	w.Write(header)
+	for a, i := range idx {
+		record := []string{strconv.Itoa(i)}
+		for _, v := range prox[a] {
+			record = append(record, strconv.FormatFloat(v, 'g', 4, 64))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"proj3/concurrent"
+)
+
+// Function to copy the node and all the nodes below it
+func (node *DNode) clone() DNode {
+	c := *node
+	if node.children != nil {
+		c.children = make([]DNode, len(node.children))
+		for k := range node.children {
+			c.children[k] = node.children[k].clone()
+		}
+	}
+	return c
+}
+
+// Function to copy the tree, so that the copy can be pruned on its own
+func (T *Tree) copyTree() *Tree {
+	c := *T
+	c.root = T.root.clone()
+	return &c
+}
+
+// Function to turn a split node into a leaf predicting its majority class.
+// The training values kept in the leaves below it are kept in the new leaf
+func (node *DNode) makeLeaf() {
+	if node.nodeType != "leaf" {
+		for k := range node.children {
+			child := &node.children[k]
+			child.makeLeaf()
+			node.values = append(node.values, child.values...)
+			node.valueWeights = append(node.valueWeights, child.valueWeights...)
+		}
+	}
+	node.nodeType = "leaf"
+	node.children = nil
+	node.categorical = false
+	node.leftCategories = nil
+}
+
+// Function to find the risk of the leaves below the node, i.e. the sum of
+// their impurities weighted by the fraction of the total weight n of the rows
+// reaching them, the number of those leaves and the smallest effective alpha
+// of the split nodes below the node. The effective alpha of a split node is the increase in risk
+// per leaf removed when the node is pruned to a leaf
+func (node *DNode) weakestLink(n float64) (float64, int, float64) {
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return node.weight / n * node.impurity, 1, math.Inf(1)
+	}
+	risk0, leaves0, min0 := node.children[0].weakestLink(n)
+	risk1, leaves1, min1 := node.children[1].weakestLink(n)
+	risk, leaves := risk0+risk1, leaves0+leaves1
+	g := (node.weight/n*node.impurity - risk) / float64(leaves-1)
+	return risk, leaves, math.Min(g, math.Min(min0, min1))
+}
+
+// Function to prune every split node below the node whose effective alpha is
+// at most alpha, returning the risk and the number of leaves left
+func (node *DNode) cut(n float64, alpha float64) (float64, int) {
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return node.weight / n * node.impurity, 1
+	}
+	risk0, leaves0 := node.children[0].cut(n, alpha)
+	risk1, leaves1 := node.children[1].cut(n, alpha)
+	risk, leaves := risk0+risk1, leaves0+leaves1
+	own := node.weight / n * node.impurity
+	if (own-risk)/float64(leaves-1) <= alpha+1e-12 {
+		node.makeLeaf()
+		return own, 1
+	}
+	return risk, leaves
+}
+
+// Function to prune the tree with minimal cost-complexity pruning: the weakest
+// links are pruned one after the other as long as their effective alpha is at
+// most alpha
+func (T *Tree) prune(alpha float64) {
+	n := T.root.weight
+	if n == 0 {
+		return
+	}
+	for T.root.nodeType != "leaf" {
+		_, _, weakest := T.root.weakestLink(n)
+		if weakest > alpha {
+			break
+		}
+		T.root.cut(n, weakest)
+	}
+}
+
+// PruningPath returns the effective alphas at which the tree loses its weakest
+// links, starting from 0 for the full tree, and the total risk of the leaves
+// of the tree pruned at each of them. The tree itself is not changed
+func (T *Tree) PruningPath() ([]float64, []float64) {
+	root := T.root.clone()
+	n := root.weight
+	if n == 0 {
+		return []float64{0}, []float64{0}
+	}
+	risk, _, _ := root.weakestLink(n)
+	alphas, impurities := []float64{0}, []float64{risk}
+	for root.nodeType != "leaf" {
+		_, _, weakest := root.weakestLink(n)
+		risk, _ = root.cut(n, weakest)
+		alphas = append(alphas, weakest)
+		impurities = append(impurities, risk)
+	}
+	return alphas, impurities
+}
+
+// Function to print the pruning path of a tree
+func PrintPruningPath(alphas []float64, impurities []float64) {
+	fmt.Printf("%-6s %12s %12s\n", "step", "alpha", "impurity")
+	for k := range alphas {
+		fmt.Printf("%-6d %12.6f %12.6f\n", k, alphas[k], impurities[k])
+	}
+}
+
+// Creating a callable growing a tree on every fold but one and scoring it,
+// pruned with each of the alphas, on the fold left out
+type PruneFoldTask struct {
+	X      Matrix
+	y      []float64
+	train  []int
+	test   []int
+	config *ForestConfig
+	alphas []float64
+	seed   int64
+}
+
+// Defining the Call function for the Executor
+func (task *PruneFoldTask) Call() interface{} {
+	tree := calculateIntervals(task.X, task.y, task.train, task.config, task.seed)
+	scores := make([]float64, len(task.alphas))
+	for k, alpha := range task.alphas {
+		pruned := tree.copyTree()
+		pruned.prune(alpha)
+		acc := 0
+		for j, pred := range pruned.predict(task.X, task.test) {
+			if pred == task.y[task.test[j]] {
+				acc++
+			}
+		}
+		scores[k] = float64(acc) / float64(len(task.test))
+	}
+	return scores
+}
+
+// SelectAlphaCV chooses the alpha to prune the trees with by k-fold cross
+// validation on the rows train of the data. The candidates are the geometric
+// means of consecutive alphas of the pruning path of a tree grown on all the
+// rows; each fold grows a tree with the settings of the forest on the other
+// folds and scores it pruned with every candidate. The candidate with the
+// best mean accuracy wins, the largest one on ties. The folds are run on the
+// executor. The tree of the path is grown from the seed, the rows are dealt
+// into the folds from treeSeed(seed, -1) and the tree of fold f is grown from
+// treeSeed(seed, f)
+func SelectAlphaCV(executor concurrent.ExecutorService, X Matrix, y []float64, train []int, config *ForestConfig, folds int, seed int64) (float64, []float64, []float64) {
+	grow := *config
+	grow.ccpAlpha, grow.bootstrap, grow.classCounts = 0, false, nil
+
+	path, _ := calculateIntervals(X, y, train, &grow, seed).PruningPath()
+	alphas := []float64{0}
+	for k := 1; k < len(path); k++ {
+		if k+1 < len(path) {
+			alphas = append(alphas, math.Sqrt(path[k]*path[k+1]))
+		} else {
+			alphas = append(alphas, path[k])
+		}
+	}
+
+	perm := rand.New(rand.NewSource(treeSeed(seed, -1))).Perm(len(train))
+	var tasks []concurrent.Callable
+	for f := 0; f < folds; f++ {
+		var foldTrain, foldTest []int
+		for k, p := range perm {
+			if k%folds == f {
+				foldTest = append(foldTest, train[p])
+			} else {
+				foldTrain = append(foldTrain, train[p])
+			}
+		}
+		tasks = append(tasks, &PruneFoldTask{X: X, y: y, train: foldTrain, test: foldTest, config: &grow, alphas: alphas, seed: treeSeed(seed, f)})
+	}
+
+	scores := make([]float64, len(alphas))
+	for _, result := range runTasks(executor, tasks) {
+		for k, acc := range result.([]float64) {
+			scores[k] += acc / float64(folds)
+		}
+	}
+	best := 0
+	for k := range scores {
+		if scores[k] >= scores[best] {
+			best = k
+		}
+	}
+	return alphas[best], alphas, scores
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"proj3/concurrent"
+	"sort"
+	"strconv"
+)
+
+// Function to parse a comma separated list of quantiles between 0 and 1
+func ParseQuantiles(str string) ([]float64, error) {
+	var qs []float64
+	for _, part := range SplitList(str) {
+		q, err := strconv.ParseFloat(part, 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("bad quantile %q, expected a number between 0 and 1", part)
+		}
+		qs = append(qs, q)
+	}
+	return qs, nil
+}
+
+// Quantiles returns the conditional quantiles qs of the y variable for row
+// i of the data, as in quantile regression forests: every training row in
+// the leaf that row i reaches in a tree gets its weight over the total
+// weight of that leaf, averaged over the trees, and the quantiles are read
+// from the distribution of the y values with those weights. The leaves of
+// the trees must keep their values
+func (F *Forest) Quantiles(X Matrix, i int, qs []float64) []float64 {
+	var values, weights []float64
+	for _, tree := range F.trees {
+		leaf := tree.leafOf(X, i)
+		total := sum(leaf.valueWeights)
+		if total <= 0 {
+			continue
+		}
+		for k, v := range leaf.values {
+			values = append(values, v)
+			weights = append(weights, leaf.valueWeights[k]/total/float64(len(F.trees)))
+		}
+	}
+	return weightedQuantiles(values, weights, qs)
+}
+
+// Function to find the quantiles qs of the values with weights: the
+// smallest value whose cumulative weight reaches q of the total weight
+func weightedQuantiles(values []float64, weights []float64, qs []float64) []float64 {
+	quantiles := make([]float64, len(qs))
+	if len(values) == 0 {
+		return quantiles
+	}
+	order := make([]int, len(values))
+	for k := range order {
+		order[k] = k
+	}
+	sort.Slice(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+	total := sum(weights)
+
+	for j, q := range qs {
+		cum := 0.0
+		quantiles[j] = values[order[len(order)-1]]
+		for _, k := range order {
+			cum += weights[k]
+			if cum >= q*total-1e-12 && weights[k] > 0 {
+				quantiles[j] = values[k]
+				break
+			}
+		}
+	}
+	return quantiles
+}
+
+// Creating a callable finding the quantiles of one row
+type QuantileTask struct {
+	forest *Forest
+	X      Matrix
+	i      int
+	qs     []float64
+}
+
+// Defining the Call function for the Executor
+func (task *QuantileTask) Call() interface{} {
+	return task.forest.Quantiles(task.X, task.i, task.qs)
+}
+
+// Function to find the quantiles qs of the rows idx of the data, one task
+// per row
+func (F *Forest) QuantileRows(executor concurrent.ExecutorService, X Matrix, idx []int, qs []float64) [][]float64 {
+	var tasks []concurrent.Callable
+	for _, i := range idx {
+		tasks = append(tasks, &QuantileTask{forest: F, X: X, i: i, qs: qs})
+	}
+	var quantiles [][]float64
+	for _, result := range runTasks(executor, tasks) {
+		quantiles = append(quantiles, result.([]float64))
+	}
+	return quantiles
+}
+
+// Function to print how often the y values fall between the lowest and the
+// highest quantile and how wide that interval is on average
+func PrintIntervalCoverage(quantiles [][]float64, qs []float64, yTrue []float64) {
+	if len(qs) < 2 || len(yTrue) == 0 {
+		return
+	}
+	lo, hi := 0, 0
+	for k := range qs {
+		if qs[k] < qs[lo] {
+			lo = k
+		}
+		if qs[k] > qs[hi] {
+			hi = k
+		}
+	}
+	covered, width := 0, 0.0
+	for j, v := range yTrue {
+		if v >= quantiles[j][lo] && v <= quantiles[j][hi] {
+			covered++
+		}
+		width += (quantiles[j][hi] - quantiles[j][lo]) / float64(len(yTrue))
+	}
+	fmt.Printf("Interval [q%g, q%g]: coverage %.4f, mean width %.4f\n", qs[lo], qs[hi], float64(covered)/float64(len(yTrue)), width)
+}
+
+// Function to write the actual and predicted values of the test data to a
+// csv with one more column for each quantile
+func WriteQuantilePredictions(path string, yPred []float64, yTrue []float64, qs []float64, quantiles [][]float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"actual", "predicted"}
+	for _, q := range qs {
+		header = append(header, "q"+strconv.FormatFloat(q, 'g', -1, 64))
+	}
+	w.Write(header)
+	for j := range yTrue {
+		record := []string{strconv.FormatFloat(yTrue[j], 'g', -1, 64), strconv.FormatFloat(yPred[j], 'g', -1, 64)}
+		for _, v := range quantiles[j] {
+			record = append(record, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWeightedQuantiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		weights []float64
+		qs      []float64
+		want    []float64
+	}{
+		{name: "no values", qs: []float64{0.5}, want: []float64{0}},
+		{name: "equal weights", values: []float64{3, 1, 2, 4}, weights: []float64{1, 1, 1, 1}, qs: []float64{0, 0.25, 0.5, 0.75, 1}, want: []float64{1, 1, 2, 3, 4}},
+		{name: "heavy value", values: []float64{1, 2, 3}, weights: []float64{1, 8, 1}, qs: []float64{0.05, 0.5, 0.95}, want: []float64{1, 2, 3}},
+		{name: "zero weights", values: []float64{1, 2, 3}, weights: []float64{0, 1, 0}, qs: []float64{0, 1}, want: []float64{2, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := weightedQuantiles(test.values, test.weights, test.qs); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got the quantiles %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuantileForestSaveLoad(t *testing.T) {
+	X, _, columns := testData(200, 3)
+	yReg, target := testRegressionLabel(X)
+	rows := allRows(X.Rows())
+	qs := []float64{0.1, 0.5, 0.9}
+
+	F := testForest(X, yReg, columns, target, &ForestConfig{maxDepth: 10, bootstrap: true, regression: true, keepValues: true, minSamplesLeaf: 3}, 10, 5)
+	loaded := saveLoad(t, F)
+	if got, want := loaded.predictions(X, rows), F.predictions(X, rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("the loaded forest predicts %v, want %v", got[:5], want[:5])
+	}
+	for _, i := range []int{0, 50, 199} {
+		want := F.Quantiles(X, i, qs)
+		if want[0] > want[1] || want[1] > want[2] {
+			t.Errorf("row %d: the quantiles %v are not in order", i, want)
+		}
+		if got := loaded.Quantiles(X, i, qs); !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: the loaded forest gives the quantiles %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestQuantileForestOnNumericLabel(t *testing.T) {
+	// Two groups of rows far apart, with labels that are not class codes
+	var text strings.Builder
+	for i := 0; i < 80; i++ {
+		x, v := i%2, 1000+float64(i%5)/4
+		if x == 1 {
+			v = -50 - float64(i%5)/4
+		}
+		fmt.Fprintf(&text, "%d,%g\n", x, v)
+	}
+	ds, err := LoadDataset(writeCSV(t, text.String()), LoadOptions{NumericLabel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.label.levels) != 0 {
+		t.Fatalf("the numeric label has the classes %v", ds.label.levels)
+	}
+
+	F := testForest(ds.X, ds.y, ds.columns, ds.label, &ForestConfig{maxDepth: 4, bootstrap: true, regression: true, keepValues: true}, 10, 3)
+	for _, i := range []int{0, 1} {
+		lo, hi := 1000.0, 1001.0
+		if i == 1 {
+			lo, hi = -51, -50
+		}
+		for _, q := range F.Quantiles(ds.X, i, []float64{0.05, 0.5, 0.95}) {
+			if q < lo || q > hi {
+				t.Errorf("row %d: the quantile %g is outside the labels of its group, %g to %g", i, q, lo, hi)
+			}
+		}
+	}
+	if r2 := F.oobScore(ds.X, ds.y); r2 < 0.99 {
+		t.Errorf("got the out-of-bag R2 %g, want at least 0.99", r2)
+	}
+}
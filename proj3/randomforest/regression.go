@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Function to find the mean of the values with weights w
+func weightedMean(y []float64, w []float64) float64 {
+	total, sumY := 0.0, 0.0
+	for k, v := range y {
+		total += w[k]
+		sumY += w[k] * v
+	}
+	if total <= 0 {
+		return 0
+	}
+	return sumY / total
+}
+
+// Function to find the variance of the values with weights w
+func variance(y []float64, w []float64) float64 {
+	total, sumY, sumY2 := 0.0, 0.0, 0.0
+	for k, v := range y {
+		total += w[k]
+		sumY += w[k] * v
+		sumY2 += w[k] * v * v
+	}
+	return varianceSums(total, sumY, sumY2)
+}
+
+// Function to find the variance from the total weight of the rows and the
+// weighted sums of their values and of the squares of their values
+func varianceSums(total float64, sumY float64, sumY2 float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	mean := sumY / total
+	return math.Max(0, sumY2/total-mean*mean)
+}
+
+// Function to find the impurity of the rows with weights w: their variance
+// in a regression tree and their entropy otherwise
+func (T *Tree) impurity(y []float64, w []float64) float64 {
+	if T.regression {
+		return variance(y, w)
+	}
+	return T.entropy(y, w)
+}
+
+// Helper function to importance for the numeric columns of a regression
+// tree. Returns the least weighted variance of the children over the split
+// points of the column and the split point reaching it. With a monotonic
+// constraint of direction 1 (or -1) on the column, only the split points
+// where the mean of the right child is not below (or above) the mean of the
+// left child are kept
+func (T *Tree) importanceContReg(X []float64, y []float64, w []float64, direction int) (float64, float64) {
+
+	// Sorting the values of the column along with their rows
+	newX := Slice{
+		Float64Slice: sort.Float64Slice(X),
+		idx:          make([]int, len(X)),
+	}
+	for i := range newX.idx {
+		newX.idx[i] = i
+	}
+	sort.Sort(newX)
+
+	n := len(y)
+	total, sumY, sumY2 := 0.0, 0.0, 0.0
+	for k := range y {
+		total += w[k]
+		sumY += w[k] * y[k]
+		sumY2 += w[k] * y[k] * y[k]
+	}
+
+	minVar := math.Inf(2)
+	val := float64(n - 1)
+
+	// Moving the rows one by one to the left child, keeping the sums of
+	// both children up to date
+	wLeft, sumLeft, sumLeft2 := 0.0, 0.0, 0.0
+	for i := 0; i < n-1; i++ {
+		k := newX.idx[i]
+		wLeft += w[k]
+		sumLeft += w[k] * y[k]
+		sumLeft2 += w[k] * y[k] * y[k]
+		if X[i] == X[i+1] || i+1 < T.minSamplesLeaf || n-i-1 < T.minSamplesLeaf || total <= 0 {
+			continue
+		}
+		if direction != 0 && wLeft > 0 && wLeft < total {
+			gap := (sumY-sumLeft)/(total-wLeft) - sumLeft/wLeft
+			if float64(direction)*gap < 0 {
+				continue
+			}
+		}
+
+		thisVar := wLeft/total*varianceSums(wLeft, sumLeft, sumLeft2) +
+			(total-wLeft)/total*varianceSums(total-wLeft, sumY-sumLeft, sumY2-sumLeft2)
+		if thisVar < minVar {
+			minVar = thisVar
+			val = (X[i] + X[i+1]) / 2
+		}
+	}
+	return minVar, val
+}
+
+// Helper function to importance for the categorical columns of a regression
+// tree. The categories are sorted by the mean value of their rows, which
+// makes the best split between the sorted categories the best split of the
+// categories into two sets
+func (T *Tree) importanceCatReg(X []float64, y []float64, w []float64) (float64, map[float64]bool) {
+	catTotal := make(map[float64]float64)
+	catSum := make(map[float64]float64)
+	catSum2 := make(map[float64]float64)
+	catRows := make(map[float64]int)
+	for k, cat := range X {
+		catTotal[cat] += w[k]
+		catSum[cat] += w[k] * y[k]
+		catSum2[cat] += w[k] * y[k] * y[k]
+		catRows[cat]++
+	}
+	if len(catRows) < 2 {
+		return math.Inf(2), nil
+	}
+
+	var cats []float64
+	for cat := range catRows {
+		cats = append(cats, cat)
+	}
+	mean := func(cat float64) float64 {
+		if catTotal[cat] <= 0 {
+			return 0
+		}
+		return catSum[cat] / catTotal[cat]
+	}
+	sortCategories(cats, mean)
+
+	total, sumY, sumY2 := sum(w), 0.0, 0.0
+	for _, cat := range cats {
+		sumY += catSum[cat]
+		sumY2 += catSum2[cat]
+	}
+
+	minVar := math.Inf(2)
+	best := 0
+	wLeft, sumLeft, sumLeft2 := 0.0, 0.0, 0.0
+	rowsLeft := 0
+	for k := 0; k < len(cats)-1; k++ {
+		wLeft += catTotal[cats[k]]
+		sumLeft += catSum[cats[k]]
+		sumLeft2 += catSum2[cats[k]]
+		rowsLeft += catRows[cats[k]]
+		if rowsLeft < T.minSamplesLeaf || len(y)-rowsLeft < T.minSamplesLeaf || total <= 0 {
+			continue
+		}
+
+		thisVar := wLeft/total*varianceSums(wLeft, sumLeft, sumLeft2) +
+			(total-wLeft)/total*varianceSums(total-wLeft, sumY-sumLeft, sumY2-sumLeft2)
+		if thisVar < minVar {
+			minVar = thisVar
+			best = k
+		}
+	}
+
+	if math.IsInf(minVar, 1) {
+		return minVar, nil
+	}
+	leftSet := make(map[float64]bool)
+	for k := 0; k <= best; k++ {
+		leftSet[cats[k]] = true
+	}
+	return minVar, leftSet
+}
+
+// Function to find the leaf of the tree that row i of the data reaches
+func (T *Tree) leafOf(X Matrix, i int) *DNode {
+	thisNode := &T.root
+	for thisNode.nodeType != "leaf" && len(thisNode.children) == 2 {
+		if thisNode.goesLeft(X, i) {
+			thisNode = &thisNode.children[0]
+		} else {
+			thisNode = &thisNode.children[1]
+		}
+	}
+	return thisNode
+}
+
+// Function to find the root mean squared error and the coefficient of
+// determination R2 of the predictions
+func RegressionScores(yPred []float64, yTrue []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range yTrue {
+		mean += v / float64(len(yTrue))
+	}
+	sse, sst := 0.0, 0.0
+	for j := range yTrue {
+		sse += (yTrue[j] - yPred[j]) * (yTrue[j] - yPred[j])
+		sst += (yTrue[j] - mean) * (yTrue[j] - mean)
+	}
+	r2 := 0.0
+	if sst > 0 {
+		r2 = 1 - sse/sst
+	}
+	return math.Sqrt(sse / float64(len(yTrue))), r2
+}
+
+// Function to write the actual and predicted values of the test data to a csv
+func WriteRegressionPredictions(path string, yPred []float64, yTrue []float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"actual", "predicted"})
+	for j := range yTrue {
+		w.Write([]string{strconv.FormatFloat(yTrue[j], 'g', -1, 64), strconv.FormatFloat(yPred[j], 'g', -1, 64)})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"proj3/concurrent"
+	"sort"
+)
+
+// Element of the path of unique features followed by TreeSHAP. zero is the
+// fraction of the rows that follow the path when the feature is unknown, one
+// is 1 if the explained row follows the path and weight is the proportion of
+// the feature subsets of each size that go through the path
+type pathElement struct {
+	feature int
+	zero    float64
+	one     float64
+	weight  float64
+}
+
+// Function to add a feature to the path, updating the weights of the subsets
+func extendPath(path []pathElement, zero float64, one float64, feature int) []pathElement {
+	l := len(path)
+	path = append(path, pathElement{feature: feature, zero: zero, one: one})
+	if l == 0 {
+		path[l].weight = 1
+	}
+	for i := l - 1; i >= 0; i-- {
+		path[i+1].weight += one * path[i].weight * float64(i+1) / float64(l+1)
+		path[i].weight = zero * path[i].weight * float64(l-i) / float64(l+1)
+	}
+	return path
+}
+
+// Function to undo the extension of the path by the feature at pos
+func unwindPath(path []pathElement, pos int) []pathElement {
+	l := len(path) - 1
+	one, zero := path[pos].one, path[pos].zero
+	next := path[l].weight
+	for i := l - 1; i >= 0; i-- {
+		if one != 0 {
+			tmp := path[i].weight
+			path[i].weight = next * float64(l+1) / (float64(i+1) * one)
+			next = tmp - path[i].weight*zero*float64(l-i)/float64(l+1)
+		} else {
+			path[i].weight = path[i].weight * float64(l+1) / (zero * float64(l-i))
+		}
+	}
+	for i := pos; i < l; i++ {
+		path[i].feature, path[i].zero, path[i].one = path[i+1].feature, path[i+1].zero, path[i+1].one
+	}
+	return path[:l]
+}
+
+// Function to find the total weight of the path once the feature at pos
+// has been unwound, without changing the path
+func unwoundPathSum(path []pathElement, pos int) float64 {
+	l := len(path) - 1
+	one, zero := path[pos].one, path[pos].zero
+	next := path[l].weight
+	total := 0.0
+	for i := l - 1; i >= 0; i-- {
+		if one != 0 {
+			tmp := next * float64(l+1) / (float64(i+1) * one)
+			total += tmp
+			next = path[i].weight - tmp*zero*float64(l-i)/float64(l+1)
+		} else {
+			total += path[i].weight / zero / (float64(l-i) / float64(l+1))
+		}
+	}
+	return total
+}
+
+// Function to get the output of a leaf for every class. A tree votes for the
+// class predicted by the leaf
+func (T *Tree) leafValue(node *DNode, classes int) []float64 {
+	v := make([]float64, classes)
+	if k := int(node.predictedClass); k >= 0 && k < classes {
+		v[k] = 1
+	}
+	return v
+}
+
+// Helper function to shapValues, following every path of the tree from node
+func (T *Tree) treeShap(X Matrix, i int, node *DNode, parent []pathElement, zero float64, one float64, feature int, phi [][]float64) {
+	path := make([]pathElement, len(parent), len(parent)+1)
+	copy(path, parent)
+	path = extendPath(path, zero, one, feature)
+
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		v := T.leafValue(node, len(phi[0]))
+		for k := 1; k < len(path); k++ {
+			w := unwoundPathSum(path, k)
+			for c := range v {
+				phi[path[k].feature][c] += w * (path[k].one - path[k].zero) * v[c]
+			}
+		}
+		return
+	}
+
+	// The hot child is the one the row goes to
+	hot, cold := &node.children[0], &node.children[1]
+	if !node.goesLeft(X, i) {
+		hot, cold = cold, hot
+	}
+
+	// Undoing an earlier split on the same feature so that it is redone here
+	inZero, inOne := 1.0, 1.0
+	for k := 1; k < len(path); k++ {
+		if path[k].feature == node.testAttribute {
+			inZero, inOne = path[k].zero, path[k].one
+			path = unwindPath(path, k)
+			break
+		}
+	}
+
+	n := float64(node.nSamples)
+	T.treeShap(X, i, hot, path, float64(hot.nSamples)/n*inZero, inOne, node.testAttribute, phi)
+	if cold.nSamples > 0 {
+		T.treeShap(X, i, cold, path, float64(cold.nSamples)/n*inZero, 0, node.testAttribute, phi)
+	}
+}
+
+// Function to find the mean output of the tree over its training rows
+func (T *Tree) expectedValue(node *DNode, classes int) []float64 {
+	if node.nodeType == "leaf" || len(node.children) != 2 {
+		return T.leafValue(node, classes)
+	}
+	v := make([]float64, classes)
+	for k := range node.children {
+		child := &node.children[k]
+		if child.nSamples == 0 {
+			continue
+		}
+		frac := float64(child.nSamples) / float64(node.nSamples)
+		for c, val := range T.expectedValue(child, classes) {
+			v[c] += frac * val
+		}
+	}
+	return v
+}
+
+// Function to find the exact SHAP value of every column of the data for
+// every class, explaining the vote of the tree for row i
+func (T *Tree) shapValues(X Matrix, i int, classes int) [][]float64 {
+	phi := make([][]float64, X.Cols())
+	for j := range phi {
+		phi[j] = make([]float64, classes)
+	}
+	T.treeShap(X, i, &T.root, nil, 1, 1, -1, phi)
+	return phi
+}
+
+// Explanation of the prediction of the forest for one row. The fraction of
+// the votes going to each class is the base value plus the SHAP values of
+// all the features for that class
+type Explanation struct {
+	row   int
+	votes []float64
+	base  []float64
+	shap  [][]float64
+}
+
+// Explain returns the TreeSHAP explanation of the votes of the forest for
+// row i of the data, averaging the exact SHAP values of the trees
+func (F *Forest) Explain(X Matrix, i int) Explanation {
+	classes := len(F.label.levels)
+	e := Explanation{row: i, votes: make([]float64, classes), base: make([]float64, classes), shap: make([][]float64, X.Cols())}
+	for j := range e.shap {
+		e.shap[j] = make([]float64, classes)
+	}
+	n := float64(len(F.trees))
+	for _, tree := range F.trees {
+		for c, v := range tree.expectedValue(&tree.root, classes) {
+			e.base[c] += v / n
+		}
+		for j, row := range tree.shapValues(X, i, classes) {
+			for c, v := range row {
+				e.shap[j][c] += v / n
+			}
+		}
+		if k := int(tree.predict(X, []int{i})[0]); k >= 0 && k < classes {
+			e.votes[k] += 1 / n
+		}
+	}
+	return e
+}
+
+// Creating a callable explaining one row
+type ExplainTask struct {
+	forest *Forest
+	X      Matrix
+	i      int
+}
+
+// Defining the Call function for the Executor
+func (task *ExplainTask) Call() interface{} {
+	return task.forest.Explain(task.X, task.i)
+}
+
+// Function to explain the rows idx of the data, one task per row
+func (F *Forest) ExplainRows(executor concurrent.ExecutorService, X Matrix, idx []int) []Explanation {
+	var tasks []concurrent.Callable
+	for _, i := range idx {
+		tasks = append(tasks, &ExplainTask{forest: F, X: X, i: i})
+	}
+	var explanations []Explanation
+	for _, result := range runTasks(executor, tasks) {
+		explanations = append(explanations, result.(Explanation))
+	}
+	return explanations
+}
+
+// Function to print, for every explained row, the predicted class and the
+// top features pushing the votes towards or away from it
+func PrintExplanations(explanations []Explanation, X Matrix, columns []Column, label Column, top int) {
+	for _, e := range explanations {
+		predicted := 0
+		for c := range e.votes {
+			if e.votes[c] > e.votes[predicted] {
+				predicted = c
+			}
+		}
+		fmt.Printf("row %d: predicted %s (votes %.3f, base %.3f)\n", e.row, label.level(float64(predicted)), e.votes[predicted], e.base[predicted])
+
+		order := make([]int, len(e.shap))
+		for j := range order {
+			order[j] = j
+		}
+		if top <= 0 || top > len(order) {
+			top = len(order)
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return math.Abs(e.shap[order[a]][predicted]) > math.Abs(e.shap[order[b]][predicted])
+		})
+		for _, j := range order[:top] {
+			if e.shap[j][predicted] == 0 {
+				break
+			}
+			value := fmt.Sprint(X.At(e.row, j))
+			if columns[j].categorical {
+				value = columns[j].level(X.At(e.row, j))
+			}
+			fmt.Printf("  %-20s = %-12s %+.4f\n", columns[j].name, value, e.shap[j][predicted])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// Function to make a dataset of n rows drawn from the seed, with two numeric
+// columns and a categorical one of three categories. The class is 0, 1 or 2
+// from the first and the categorical column, with a tenth of the rows flipped
+func testData(n int, seed int64) (*ColMatrix, []float64, []Column) {
+	rng := rand.New(rand.NewSource(seed))
+	X := NewColMatrix(n, 3, false)
+	y := make([]float64, n)
+	for i := 0; i < n; i++ {
+		X.Set(i, 0, rng.Float64())
+		X.Set(i, 1, rng.NormFloat64())
+		X.Set(i, 2, float64(rng.Intn(3)))
+		y[i] = math.Floor(X.At(i, 0) * 3)
+		if X.At(i, 2) == 2 {
+			y[i] = 2 - y[i]
+		}
+		if rng.Float64() < 0.1 {
+			y[i] = float64(rng.Intn(3))
+		}
+	}
+	columns := []Column{{name: "x0"}, {name: "x1"}, {name: "x2", categorical: true, codes: make(map[string]int)}}
+	for _, v := range []string{"a", "b", "c"} {
+		columns[2].encode(v)
+	}
+	return X, y, columns
+}
+
+// Function to grow a forest of the given number of trees on all the rows of
+// the data, the trees drawing their random numbers from the seed
+func testForest(X Matrix, y []float64, columns []Column, label Column, config *ForestConfig, trees int, seed int64) *Forest {
+	if config.sqrtCols == 0 {
+		config.sqrtCols = X.Cols()
+	}
+	if config.categorical == nil {
+		config.categorical = make([]bool, len(columns))
+		for j := range columns {
+			config.categorical[j] = columns[j].categorical
+		}
+	}
+	train := allRows(X.Rows())
+	F := &Forest{columns: columns, label: label, config: config, seed: seed, rows: X.Rows()}
+	for k := 0; k < trees; k++ {
+		F.trees = append(F.trees, calculateIntervals(X, y, train, config, treeSeed(seed, k)))
+	}
+	return F
+}
+
+func TestExplainAddsUpToVotes(t *testing.T) {
+	X, y, columns := testData(300, 1)
+	label := newLabelColumn("class", []string{"0", "1", "2"})
+	tests := []struct {
+		name   string
+		config ForestConfig
+	}{
+		{name: "full trees", config: ForestConfig{maxDepth: 20}},
+		{name: "shallow trees", config: ForestConfig{maxDepth: 2}},
+		{name: "bootstrap", config: ForestConfig{maxDepth: 6, bootstrap: true, sqrtCols: 2}},
+		{name: "extra trees", config: ForestConfig{maxDepth: 8, extraTrees: true, minSamplesLeaf: 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			F := testForest(X, y, columns, label, &test.config, 10, 7)
+			for _, i := range []int{0, 1, 17, 123, 299} {
+				e := F.Explain(X, i)
+				for c := range label.levels {
+					total := e.base[c]
+					for j := range e.shap {
+						total += e.shap[j][c]
+					}
+					if math.Abs(total-e.votes[c]) > 1e-9 {
+						t.Errorf("row %d, class %s: base plus SHAP values is %g, want the votes %g", i, label.levels[c], total, e.votes[c])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTreeShapSingleSplit(t *testing.T) {
+	// One split on x0 at 0.5: rows below go to class 0, the others to class 1
+	X := NewColMatrix(4, 2, false)
+	y := make([]float64, 4)
+	for i := 0; i < 4; i++ {
+		X.Set(i, 0, float64(i)/4)
+		X.Set(i, 1, float64(i%2))
+		if i >= 2 {
+			y[i] = 1
+		}
+	}
+	columns := []Column{{name: "x0"}, {name: "x1"}}
+	label := newLabelColumn("class", []string{"0", "1"})
+	F := testForest(X, y, columns, label, &ForestConfig{maxDepth: 1, features: []int{0}, sqrtCols: 1}, 1, 1)
+
+	tests := []struct {
+		row  int
+		shap [2]float64
+	}{
+		{row: 0, shap: [2]float64{0.5, -0.5}},
+		{row: 3, shap: [2]float64{-0.5, 0.5}},
+	}
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.row), func(t *testing.T) {
+			e := F.Explain(X, test.row)
+			for c := range test.shap {
+				if math.Abs(e.base[c]-0.5) > 1e-12 {
+					t.Errorf("class %d: base value %g, want 0.5", c, e.base[c])
+				}
+				if math.Abs(e.shap[0][c]-test.shap[c]) > 1e-12 {
+					t.Errorf("class %d: SHAP value of x0 %g, want %g", c, e.shap[0][c], test.shap[c])
+				}
+				if e.shap[1][c] != 0 {
+					t.Errorf("class %d: SHAP value of x1 %g, want 0", c, e.shap[1][c])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sparse matrix stored column by column. Only the values that are not zero
+// are kept, with the rows they are in sorted in increasing order
+type SparseMatrix struct {
+	rows    int
+	colRows [][]int32
+	colVals [][]float64
+}
+
+func (M *SparseMatrix) Rows() int {
+	return M.rows
+}
+
+func (M *SparseMatrix) Cols() int {
+	return len(M.colRows)
+}
+
+// Every entry that is not stored is a zero
+func (M *SparseMatrix) At(i, j int) float64 {
+	rows := M.colRows[j]
+	k := sort.Search(len(rows), func(k int) bool { return int(rows[k]) >= i })
+	if k < len(rows) && int(rows[k]) == i {
+		return M.colVals[j][k]
+	}
+	return 0
+}
+
+// Function to gather the values of a column for the given rows. Only the
+// stored values are visited, the rest of the result stays zero
+func (M *SparseMatrix) gather(idx []int, col int) []float64 {
+	ArrRet := make([]float64, len(idx))
+	rows := M.colRows[col]
+	if len(rows) == 0 {
+		return ArrRet
+	}
+
+	// Looking up rows one by one is cheaper when the column has many values
+	if len(rows) > len(idx) {
+		for k, i := range idx {
+			ArrRet[k] = M.At(i, col)
+		}
+		return ArrRet
+	}
+	pos := make(map[int]int, len(idx))
+	for k, i := range idx {
+		pos[i] = k
+	}
+	for k, i := range rows {
+		if p, ok := pos[int(i)]; ok {
+			ArrRet[p] = M.colVals[col][k]
+		}
+	}
+	return ArrRet
+}
+
+var errBadFeature = errors.New("expected index:value")
+
+// Function to check if a file is in the LIBSVM format by its extension
+func IsLibSVM(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".svm", ".libsvm", ".svmlight":
+		return true
+	}
+	return false
+}
+
+// LoadLibSVM reads a file in the LIBSVM / SVMlight sparse format, where each
+// line is a label followed by index:value pairs and anything after a # is a
+// comment. The indices are 1-based unless an index 0 appears in the file.
+// The values that are not listed are zero and are never stored. Unlabeled
+// files have index:value pairs alone on every line
+func LoadLibSVM(path string, opts LoadOptions) (*Dataset, error) {
+	if opts.Weight != "" {
+		return nil, fmt.Errorf("%s: libsvm files have no weight column", path)
+	}
+	if len(opts.Outputs) > 0 {
+		return nil, fmt.Errorf("%s: libsvm files have a single y variable", path)
+	}
+	if opts.Header || opts.Label != "" {
+		return nil, fmt.Errorf("%s: libsvm files have no header and their label is the first field of every line", path)
+	}
+	if len(opts.Select) > 0 || len(opts.Drop) > 0 || len(opts.Categorical) > 0 {
+		return nil, fmt.Errorf("%s: the columns of libsvm files cannot be selected, dropped or made categorical", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{r: f}
+	scanner := bufio.NewScanner(counter)
+	scanner.Buffer(make([]byte, 1<<20), 1<<30)
+
+	// The columns are collected by their index in the file
+	colRows := make(map[int][]int32)
+	colVals := make(map[int][]float64)
+	var labelValues []string
+	labelSeen := make(map[string]bool)
+	var labels []string
+	minIndex, maxIndex := 1, 0
+	line, rows := 0, 0
+
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if k := strings.IndexByte(text, '#'); k >= 0 {
+			text = text[:k]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		row := int32(rows)
+		rows++
+		pairs, first := fields, 1
+		if !opts.Unlabeled {
+			if opts.NumericLabel && !isNumeric(fields[0]) {
+				return nil, &ParseError{Row: line, Col: 1, Name: "label", Value: fields[0], Err: errNumericLabel}
+			}
+			labelValues = append(labelValues, fields[0])
+			if !labelSeen[fields[0]] {
+				labelSeen[fields[0]] = true
+				labels = append(labels, fields[0])
+			}
+			pairs, first = fields[1:], 2
+		}
+
+		prev := -1
+		for k, field := range pairs {
+			sep := strings.IndexByte(field, ':')
+			if sep < 0 {
+				return nil, &ParseError{Row: line, Col: k + first, Name: "feature", Value: field, Err: errBadFeature}
+			}
+			if field[:sep] == "qid" {
+				continue
+			}
+			index, err1 := strconv.Atoi(field[:sep])
+			val, err2 := strconv.ParseFloat(field[sep+1:], 64)
+			if err1 != nil || err2 != nil || index < 0 || index <= prev {
+				return nil, &ParseError{Row: line, Col: k + first, Name: "feature", Value: field, Err: errBadFeature}
+			}
+			prev = index
+			if index < minIndex {
+				minIndex = index
+			}
+			if index > maxIndex {
+				maxIndex = index
+			}
+			if val != 0 {
+				colRows[index] = append(colRows[index], row)
+				colVals[index] = append(colVals[index], val)
+			}
+		}
+		if opts.Progress != nil && rows%progressEvery == 0 {
+			opts.Progress(2, rows, counter.n, info.Size())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if rows == 0 || maxIndex < minIndex {
+		return nil, fmt.Errorf("%s: no data", path)
+	}
+	if opts.Progress != nil {
+		opts.Progress(2, rows, info.Size(), info.Size())
+	}
+
+	cols := maxIndex - minIndex + 1
+	X := &SparseMatrix{rows: rows, colRows: make([][]int32, cols), colVals: make([][]float64, cols)}
+	ds := &Dataset{X: X, y: make([]float64, rows), columns: make([]Column, cols)}
+	for j := 0; j < cols; j++ {
+		X.colRows[j] = colRows[j+minIndex]
+		X.colVals[j] = colVals[j+minIndex]
+		ds.columns[j] = Column{name: fmt.Sprintf("f%d", j+minIndex)}
+	}
+	if opts.Unlabeled {
+		ds.label = newLabelColumn("", nil)
+		return ds, nil
+	}
+	ds.label = newLabelColumn("label", labels)
+	if opts.NumericLabel {
+		ds.label = Column{name: "label"}
+	}
+	for i, v := range labelValues {
+		ds.y[i] = labelValue(&ds.label, v, opts.NumericLabel)
+	}
+	return ds, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLibSVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    LoadOptions
+		rows    int
+		cols    int
+		classes int
+		at      [3]float64
+		err     bool
+	}{
+		{name: "labeled", text: "1 1:0.5 3:2\n0 2:1 # comment\n", rows: 2, cols: 3, classes: 2, at: [3]float64{0, 2, 2}},
+		{name: "zero based", text: "a 0:1 2:4\nb 1:3\n", rows: 2, cols: 3, classes: 2, at: [3]float64{1, 1, 3}},
+		{name: "unlabeled", text: "1:0.5 3:2\n2:1\n", opts: LoadOptions{Unlabeled: true}, rows: 2, cols: 3, at: [3]float64{0, 0, 0.5}},
+		{name: "header", text: "1 1:0.5\n", opts: LoadOptions{Header: true}, err: true},
+		{name: "label", text: "1 1:0.5\n", opts: LoadOptions{Label: "0"}, err: true},
+		{name: "drop", text: "1 1:0.5\n", opts: LoadOptions{Drop: []string{"f1"}}, err: true},
+		{name: "categorical", text: "1 1:0.5\n", opts: LoadOptions{Categorical: []string{"f1"}}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.svm")
+			if err := os.WriteFile(path, []byte(test.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			ds, err := LoadLibSVM(path, test.opts)
+			if test.err {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ds.X.Rows() != test.rows || ds.X.Cols() != test.cols || len(ds.label.levels) != test.classes {
+				t.Fatalf("got %d rows, %d columns and %d classes, want %d, %d and %d", ds.X.Rows(), ds.X.Cols(), len(ds.label.levels), test.rows, test.cols, test.classes)
+			}
+			i, j := int(test.at[0]), int(test.at[1])
+			if got := ds.X.At(i, j); got != test.at[2] {
+				t.Errorf("got %g at row %d, column %d, want %g", got, i, j, test.at[2])
+			}
+		})
+	}
+}
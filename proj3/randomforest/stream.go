@@ -0,0 +1,717 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"proj3/concurrent"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errStreamNumber = errors.New("expected a number, declare the column with -categorical")
+
+// Settings of the Hoeffding trees of a streaming forest
+type StreamConfig struct {
+	maxDepth int
+
+	// The number of columns picked at random for each tree
+	sqrtCols int
+
+	// The weight of the rows a leaf sees between two attempts to split it
+	grace float64
+
+	// The probability of splitting on another column than the best one, and
+	// the bound under which the best two splits are taken as tied and the
+	// best one is used anyway
+	delta float64
+	tie   float64
+
+	// The most leaves of every tree, which bounds the memory of the forest
+	maxLeaves int
+
+	// The number of thresholds tried for every numeric column of a leaf
+	bins int
+}
+
+// The running weighted mean and variance of a numeric column for one class
+// in a leaf, with its smallest and largest values
+type gaussianStats struct {
+	weight, mean, m2 float64
+	min, max         float64
+}
+
+// Function to add a value with a weight to the statistics
+func (g *gaussianStats) add(v float64, w float64) {
+	if g.weight == 0 {
+		g.min, g.max = v, v
+	}
+	g.min, g.max = math.Min(g.min, v), math.Max(g.max, v)
+	g.weight += w
+	d := v - g.mean
+	g.mean += w * d / g.weight
+	g.m2 += w * d * (v - g.mean)
+}
+
+// Function to estimate the weight of the values below t from a normal
+// distribution with the mean and variance of the values
+func (g *gaussianStats) below(t float64) float64 {
+	switch {
+	case g.weight == 0 || t <= g.min:
+		return 0
+	case t > g.max:
+		return g.weight
+	}
+	sd := math.Sqrt(g.m2 / g.weight)
+	if sd == 0 {
+		if g.mean < t {
+			return g.weight
+		}
+		return 0
+	}
+	return g.weight * 0.5 * math.Erfc(-(t-g.mean)/(sd*math.Sqrt2))
+}
+
+// Node of a Hoeffding tree. A leaf keeps the statistics of the rows it saw
+// instead of the rows, which are dropped once it is split
+type hoeffdingNode struct {
+
+	// The split of an inner node: the rows whose value of the column is below
+	// the threshold, or is the category for a categorical column, go left
+	feature     int
+	threshold   float64
+	categorical bool
+	category    float64
+	children    []*hoeffdingNode
+
+	// The weight of each class of the rows of a leaf, the statistics of the
+	// numeric columns and the weight of each class for every category of the
+	// categorical columns, and the total weight at the last attempt to split
+	classWeights []float64
+	numeric      map[int][]gaussianStats
+	categories   map[int]map[float64][]float64
+	lastTry      float64
+	depth        int
+}
+
+// Function to create a leaf starting from the weight of each class
+func newHoeffdingLeaf(classWeights []float64, depth int) *hoeffdingNode {
+	return &hoeffdingNode{
+		classWeights: classWeights,
+		numeric:      make(map[int][]gaussianStats),
+		categories:   make(map[int]map[float64][]float64),
+		lastTry:      sum(classWeights),
+		depth:        depth,
+	}
+}
+
+// Function to grow a slice of weights so that class has a place in it
+func growTo(weights []float64, class int) []float64 {
+	for len(weights) <= class {
+		weights = append(weights, 0)
+	}
+	return weights
+}
+
+// Function to find the class with the largest weight, -0.123 if there is none
+// like the empty leaves of the batch trees
+func majorityClass(weights []float64) float64 {
+	best := -1
+	for c, w := range weights {
+		if w > 0 && (best < 0 || w > weights[best]) {
+			best = c
+		}
+	}
+	if best < 0 {
+		return -0.123
+	}
+	return float64(best)
+}
+
+// Function to calculate the entropy of the weight of each class
+func classEntropy(weights []float64) float64 {
+	total := sum(weights)
+	if total <= 0 {
+		return 0
+	}
+	h := 0.0
+	for _, w := range weights {
+		if w > 0 {
+			h -= w / total * math.Log2(w/total)
+		}
+	}
+	return h
+}
+
+// A Hoeffding tree, learning one row at a time. A leaf is split once the
+// Hoeffding bound shows, with probability 1 - delta, that the best split
+// seen so far is better than the split on any other column
+type HoeffdingTree struct {
+	root   *hoeffdingNode
+	leaves int
+
+	// The columns the tree splits on and which columns are categorical
+	features    []int
+	categorical []bool
+
+	config *StreamConfig
+
+	// The seed of the random numbers drawn to grow the tree and the
+	// generator drawing them
+	seed int64
+	rng  *rand.Rand
+}
+
+// Function to find the leaf a row ends up in
+func (T *HoeffdingTree) leafOf(x []float64) *hoeffdingNode {
+	node := T.root
+	for node.children != nil {
+		if node.goesLeft(x) {
+			node = node.children[0]
+		} else {
+			node = node.children[1]
+		}
+	}
+	return node
+}
+
+// Function to check if a row goes to the left child of the node
+func (node *hoeffdingNode) goesLeft(x []float64) bool {
+	if node.categorical {
+		return x[node.feature] == node.category
+	}
+	return x[node.feature] < node.threshold
+}
+
+// Function to predict the class of a row, -0.123 if the tree saw no rows
+func (T *HoeffdingTree) predict(x []float64) float64 {
+	return majorityClass(T.leafOf(x).classWeights)
+}
+
+// Function to learn from a row of the given class and weight, splitting its
+// leaf if it saw enough rows since it was last tried
+func (T *HoeffdingTree) learn(x []float64, class int, w float64) {
+	leaf := T.leafOf(x)
+	leaf.classWeights = growTo(leaf.classWeights, class)
+	leaf.classWeights[class] += w
+	for _, j := range T.features {
+		if T.isCategorical(j) {
+			counts := leaf.categories[j]
+			if counts == nil {
+				counts = make(map[float64][]float64)
+				leaf.categories[j] = counts
+			}
+			counts[x[j]] = growTo(counts[x[j]], class)
+			counts[x[j]][class] += w
+			continue
+		}
+		stats := leaf.numeric[j]
+		for len(stats) <= class {
+			stats = append(stats, gaussianStats{})
+		}
+		stats[class].add(x[j], w)
+		leaf.numeric[j] = stats
+	}
+
+	total := sum(leaf.classWeights)
+	if total-leaf.lastTry < T.config.grace || leaf.depth >= T.config.maxDepth || T.leaves >= T.config.maxLeaves {
+		return
+	}
+	leaf.lastTry = total
+	T.trySplit(leaf, total)
+}
+
+// Function to check if a column of the data is categorical
+func (T *HoeffdingTree) isCategorical(col int) bool {
+	return col < len(T.categorical) && T.categorical[col]
+}
+
+// The best split of one column of a leaf, with the weight of each class
+// going to each side
+type streamSplit struct {
+	feature     int
+	threshold   float64
+	categorical bool
+	category    float64
+	gain        float64
+	left, right []float64
+}
+
+// Function to find the best split of a column of the leaf by information gain
+func (T *HoeffdingTree) bestSplit(leaf *hoeffdingNode, j int, parent float64, total float64) streamSplit {
+	best := streamSplit{feature: j, gain: math.Inf(-1)}
+	try := func(left []float64, threshold float64, category float64) {
+		right := make([]float64, len(leaf.classWeights))
+		for c := range right {
+			right[c] = leaf.classWeights[c] - left[c]
+		}
+		nLeft := sum(left)
+		if nLeft <= 0 || nLeft >= total {
+			return
+		}
+		gain := parent - nLeft/total*classEntropy(left) - (total-nLeft)/total*classEntropy(right)
+		if gain > best.gain {
+			best.gain, best.threshold, best.category, best.left, best.right = gain, threshold, category, left, right
+		}
+	}
+
+	if T.isCategorical(j) {
+		best.categorical = true
+		for category, counts := range leaf.categories[j] {
+			left := make([]float64, len(leaf.classWeights))
+			copy(left, counts)
+			try(left, 0, category)
+		}
+		return best
+	}
+
+	stats := leaf.numeric[j]
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, g := range stats {
+		if g.weight > 0 {
+			lo, hi = math.Min(lo, g.min), math.Max(hi, g.max)
+		}
+	}
+	if !(lo < hi) {
+		return best
+	}
+	for b := 1; b <= T.config.bins; b++ {
+		t := lo + (hi-lo)*float64(b)/float64(T.config.bins+1)
+		left := make([]float64, len(leaf.classWeights))
+		for c := range stats {
+			left[c] = stats[c].below(t)
+		}
+		try(left, t, 0)
+	}
+	return best
+}
+
+// Function to split the leaf on the best column if the Hoeffding bound
+// allows it: the gain of the best split must beat the gain of the best split
+// of any other column by more than the bound, or the bound must be under tie
+func (T *HoeffdingTree) trySplit(leaf *hoeffdingNode, total float64) {
+	classes := 0
+	for _, w := range leaf.classWeights {
+		if w > 0 {
+			classes++
+		}
+	}
+	if classes < 2 {
+		return
+	}
+
+	parent := classEntropy(leaf.classWeights)
+	best, second := streamSplit{gain: math.Inf(-1)}, 0.0
+	for _, j := range T.features {
+		split := T.bestSplit(leaf, j, parent, total)
+		if split.gain > best.gain {
+			second = math.Max(second, best.gain)
+			best = split
+		} else {
+			second = math.Max(second, split.gain)
+		}
+	}
+	if best.left == nil || best.gain <= 0 {
+		return
+	}
+
+	R := math.Log2(float64(len(leaf.classWeights)))
+	bound := math.Sqrt(R * R * math.Log(1/T.config.delta) / (2 * total))
+	if best.gain-second <= bound && bound >= T.config.tie {
+		return
+	}
+
+	// The children start from the weight of each class estimated for them,
+	// and the statistics of the leaf are dropped
+	leaf.feature, leaf.threshold = best.feature, best.threshold
+	leaf.categorical, leaf.category = best.categorical, best.category
+	leaf.children = []*hoeffdingNode{newHoeffdingLeaf(best.left, leaf.depth+1), newHoeffdingLeaf(best.right, leaf.depth+1)}
+	leaf.classWeights, leaf.numeric, leaf.categories = nil, nil, nil
+	T.leaves++
+}
+
+// Function to turn the node into a node of a batch tree, to save it with
+// the forest
+func (node *hoeffdingNode) toDNode() DNode {
+	if node.children == nil {
+		d := DNode{
+			nodeType:       "leaf",
+			predictedClass: majorityClass(node.classWeights),
+			weight:         sum(node.classWeights),
+			impurity:       classEntropy(node.classWeights),
+			distribution:   make(map[float64]float64),
+		}
+		d.nSamples = int(math.Round(d.weight))
+		for c, w := range node.classWeights {
+			if w > 0 {
+				d.distribution[float64(c)] = w
+			}
+		}
+		return d
+	}
+	left, right := node.children[0].toDNode(), node.children[1].toDNode()
+	d := DNode{
+		testAttribute: node.feature,
+		testValue:     node.threshold,
+		nSamples:      left.nSamples + right.nSamples,
+		weight:        left.weight + right.weight,
+		distribution:  make(map[float64]float64),
+		children:      []DNode{left, right},
+	}
+	if node.categorical {
+		d.categorical, d.leftCategories = true, map[float64]bool{node.category: true}
+	}
+	for _, child := range d.children {
+		for c, w := range child.distribution {
+			d.distribution[c] += w
+		}
+	}
+	counts := make([]float64, 0)
+	for c, w := range d.distribution {
+		counts = growTo(counts, int(c))
+		counts[int(c)] = w
+	}
+	d.predictedClass, d.impurity = majorityClass(counts), classEntropy(counts)
+	return d
+}
+
+// The streaming forest: Hoeffding trees fed with online bagging, every tree
+// learning each row as many times as a draw of a Poisson distribution of
+// mean 1, the number of times the row would be in its bootstrap sample
+type StreamForest struct {
+	trees   []*HoeffdingTree
+	columns []Column
+	label   Column
+	config  *StreamConfig
+
+	// The number of rows learnt from
+	rows int
+}
+
+// Function to create a streaming forest of untrained trees on the columns,
+// each splitting on sqrtCols of them picked at random with the seed of the
+// tree derived from the seed of the forest
+func NewStreamForest(trees int, columns []Column, config *StreamConfig, seed int64) *StreamForest {
+	F := &StreamForest{columns: columns, label: Column{categorical: true, codes: make(map[string]int)}, config: config}
+	categorical := make([]bool, len(columns))
+	for j := range columns {
+		categorical[j] = columns[j].categorical
+	}
+	for t := 0; t < trees; t++ {
+		tree := &HoeffdingTree{root: newHoeffdingLeaf(nil, 0), leaves: 1, categorical: categorical, config: config}
+		tree.seed = treeSeed(seed, t)
+		tree.rng = rand.New(rand.NewSource(tree.seed))
+		tree.features = tree.rng.Perm(len(columns))[:config.sqrtCols]
+		F.trees = append(F.trees, tree)
+	}
+	return F
+}
+
+// Function to draw from a Poisson distribution of mean lambda
+func poisson(rng *rand.Rand, lambda float64) int {
+	L, k, p := math.Exp(-lambda), 0, rng.Float64()
+	for p > L {
+		k++
+		p *= rng.Float64()
+	}
+	return k
+}
+
+// Function to predict the class of a row by the votes of the trees, the
+// smallest class on ties, -1 if no tree saw a row yet
+func (F *StreamForest) Predict(x []float64) int {
+	var votes []float64
+	for _, tree := range F.trees {
+		if pred := tree.predict(x); pred >= 0 {
+			votes = growTo(votes, int(pred))
+			votes[int(pred)]++
+		}
+	}
+	if len(votes) == 0 {
+		return -1
+	}
+	return int(majorityClass(votes))
+}
+
+// Creating a callable feeding a batch of rows to one tree
+type LearnTask struct {
+	tree    *HoeffdingTree
+	rows    [][]float64
+	classes []int
+	weights []float64
+}
+
+// Defining the Call function for the Executor. The rows are learnt in order
+func (task *LearnTask) Call() interface{} {
+	for k, x := range task.rows {
+		if n := poisson(task.tree.rng, 1); n > 0 {
+			task.tree.learn(x, task.classes[k], float64(n)*task.weights[k])
+		}
+	}
+	return nil
+}
+
+// Function to let every tree learn the batch of rows, one task per tree
+func (F *StreamForest) Learn(executor concurrent.ExecutorService, rows [][]float64, classes []int, weights []float64) {
+	var tasks []concurrent.Callable
+	for _, tree := range F.trees {
+		tasks = append(tasks, &LearnTask{tree: tree, rows: rows, classes: classes, weights: weights})
+	}
+	runTasks(executor, tasks)
+	F.rows += len(rows)
+}
+
+// Function to count the leaves of all the trees
+func (F *StreamForest) leaves() int {
+	n := 0
+	for _, tree := range F.trees {
+		n += tree.leaves
+	}
+	return n
+}
+
+// Function to turn the streaming forest into a forest of batch trees with
+// the same splits and leaves, which can be saved and used like any other
+func (F *StreamForest) Forest() *Forest {
+	config := &ForestConfig{maxDepth: F.config.maxDepth, sqrtCols: F.config.sqrtCols, maxLeafNodes: F.config.maxLeaves}
+	for j := range F.columns {
+		config.categorical = append(config.categorical, F.columns[j].categorical)
+	}
+	forest := &Forest{columns: F.columns, label: F.label, config: config}
+	for _, tree := range F.trees {
+		t := config.newTree(tree.features, tree.seed)
+		t.root = tree.root.toDNode()
+		forest.trees = append(forest.trees, t)
+	}
+	return forest
+}
+
+// Reader of the lines of a stream. With follow the end of the file is waited
+// out as with tail -f, so the lines written to it later are read as well
+type lineReader struct {
+	r       *bufio.Reader
+	follow  bool
+	poll    time.Duration
+	partial string
+}
+
+// Function to read the next line, without its line break
+func (lr *lineReader) next() (string, error) {
+	for {
+		line, err := lr.r.ReadString('\n')
+		lr.partial += line
+		if err == nil || (err == io.EOF && !lr.follow && lr.partial != "") {
+			line, lr.partial = lr.partial, ""
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+		if err != io.EOF || !lr.follow {
+			return "", err
+		}
+		time.Sleep(lr.poll)
+	}
+}
+
+// Prequential accuracy of a stream: every row is predicted before it is
+// learnt, over all the rows and over the rows since the last report
+type StreamStats struct {
+	rows, correct             int
+	windowRows, windowCorrect int
+	skipped                   int
+	leaves                    int
+}
+
+// Function to print the accuracy of the stream so far
+func PrintStreamStats(stats StreamStats) {
+	acc, window := 0.0, 0.0
+	if stats.rows > 0 {
+		acc = float64(stats.correct) / float64(stats.rows)
+	}
+	if stats.windowRows > 0 {
+		window = float64(stats.windowCorrect) / float64(stats.windowRows)
+	}
+	fmt.Printf("rows %-10d accuracy %.4f  last %d rows %.4f  leaves %d  skipped %d\n", stats.rows, acc, stats.windowRows, window, stats.leaves, stats.skipped)
+}
+
+// Stream trains a streaming forest of the given number of trees on the rows
+// read from r, one line at a time, as described by opts. The first line
+// sets the columns. Columns are numeric unless declared categorical, and a
+// missing numeric value is taken as 0. Every row is first predicted and then
+// learnt by the trees, in batches of batch rows fed to the trees on the
+// executor. Rows that cannot be read are skipped. report is called with the
+// accuracy every every rows and when the stream ends
+func Stream(executor concurrent.ExecutorService, r io.Reader, follow bool, opts LoadOptions, trees int, config *StreamConfig, seed int64, batch int, every int, report func(StreamStats, *StreamForest)) (*StreamForest, error) {
+	lines := &lineReader{r: bufio.NewReader(r), follow: follow, poll: 200 * time.Millisecond}
+	parse := func(line string) ([]string, error) {
+		csvReader := csv.NewReader(strings.NewReader(line))
+		if opts.Delimiter != 0 {
+			csvReader.Comma = opts.Delimiter
+		}
+		return csvReader.Read()
+	}
+
+	first, err := lines.next()
+	if err == io.EOF {
+		return nil, errors.New("no data in the stream")
+	} else if err != nil {
+		return nil, err
+	}
+	record, err := parse(first)
+	if err != nil {
+		return nil, err
+	}
+
+	// Naming the columns from the header or from their position
+	names := make([]string, len(record))
+	for j := range names {
+		names[j] = fmt.Sprintf("col%d", j)
+		if opts.Header && strings.TrimSpace(record[j]) != "" {
+			names[j] = strings.TrimSpace(record[j])
+		}
+	}
+	labelCol := len(names) - 1
+	if opts.Label != "" {
+		if labelCol, err = resolveColumn(opts.Label, names); err != nil {
+			return nil, err
+		}
+	}
+	selected, err := resolveColumns(opts.Select, names)
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := resolveColumns(opts.Drop, names)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := resolveColumns(opts.Categorical, names)
+	if err != nil {
+		return nil, err
+	}
+	weightCol := -1
+	if opts.Weight != "" {
+		if weightCol, err = resolveColumn(opts.Weight, names); err != nil {
+			return nil, err
+		}
+	}
+	var features []int
+	var columns []Column
+	for j := range names {
+		if j == labelCol || j == weightCol || dropped[j] || (len(selected) > 0 && !selected[j]) {
+			continue
+		}
+		features = append(features, j)
+		columns = append(columns, Column{name: names[j], categorical: declared[j], codes: make(map[string]int)})
+	}
+	if len(features) == 0 {
+		return nil, errors.New("no feature columns left")
+	}
+	if config.sqrtCols < 1 || config.sqrtCols > len(features) {
+		config.sqrtCols = int(math.Round(math.Sqrt(float64(len(features) + 1))))
+		if config.sqrtCols > len(features) {
+			config.sqrtCols = len(features)
+		}
+	}
+	F := NewStreamForest(trees, columns, config, seed)
+	F.label.name = names[labelCol]
+
+	// Function to turn a record into a row of the data
+	toRow := func(record []string, row int) ([]float64, int, float64, error) {
+		if len(record) != len(names) {
+			return nil, 0, 0, &ParseError{Row: row, Err: fmt.Errorf("expected %d values, got %d", len(names), len(record))}
+		}
+		if isMissing(record[labelCol]) {
+			return nil, 0, 0, &ParseError{Row: row, Col: labelCol + 1, Name: names[labelCol], Err: errMissingLabel}
+		}
+		x := make([]float64, len(features))
+		for k, j := range features {
+			if F.columns[k].categorical {
+				x[k] = F.columns[k].encode(record[j])
+				continue
+			}
+			if isMissing(record[j]) {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(record[j]), 64)
+			if err != nil {
+				return nil, 0, 0, &ParseError{Row: row, Col: j + 1, Name: names[j], Value: record[j], Err: errStreamNumber}
+			}
+			x[k] = v
+		}
+		w := 1.0
+		if weightCol >= 0 {
+			v, err := strconv.ParseFloat(strings.TrimSpace(record[weightCol]), 64)
+			if err != nil || !(v >= 0) || math.IsInf(v, 1) {
+				return nil, 0, 0, &ParseError{Row: row, Col: weightCol + 1, Name: names[weightCol], Value: record[weightCol], Err: errBadWeight}
+			}
+			w = v
+		}
+		return x, int(F.label.encode(record[labelCol])), w, nil
+	}
+
+	var stats StreamStats
+	var rows [][]float64
+	var classes []int
+	var weights []float64
+	flush := func() {
+		if len(rows) > 0 {
+			F.Learn(executor, rows, classes, weights)
+			rows, classes, weights = nil, nil, nil
+		}
+	}
+
+	row := 1
+	if opts.Header {
+		record = nil
+	}
+	for {
+		if record != nil {
+			x, class, w, err := toRow(record, row)
+			if err != nil {
+				stats.skipped++
+			} else {
+				if pred := F.Predict(x); pred >= 0 || F.rows > 0 {
+					stats.rows++
+					stats.windowRows++
+					if pred == class {
+						stats.correct++
+						stats.windowCorrect++
+					}
+				}
+				rows, classes, weights = append(rows, x), append(classes, class), append(weights, w)
+				if len(rows) >= batch {
+					flush()
+				}
+				if every > 0 && stats.windowRows >= every {
+					flush()
+					stats.leaves = F.leaves()
+					report(stats, F)
+					stats.windowRows, stats.windowCorrect = 0, 0
+				}
+			}
+		}
+
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return F, err
+		}
+		row++
+		record = nil
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if record, err = parse(line); err != nil {
+			stats.skipped++
+			record = nil
+		}
+	}
+	flush()
+	stats.leaves = F.leaves()
+	report(stats, F)
+	return F, nil
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"encoding/csv"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"math/rand"
@@ -13,13 +14,87 @@ import (
 	"time"
 )
 
-const usage = "Usage: run_mode tree_num tree_depth threads threshold thresholdBalance\n" +
+const usage = "Usage: [explain|path|isolation|proximity|impute|stream] run_mode tree_num tree_depth threads threshold thresholdBalance [options]\n" +
+	"       export -model file -tree index [-format dot|rules] [-out file]\n" +
+	"       monotone -model file [-monotone list] [-top n]\n" +
+	"explain = Explain the predictions of the forest on the test data with TreeSHAP\n" +
+	"path = Print the decision path of the test data through every tree\n" +
+	"proximity = Find the proximities of the rows in the trees, Breiman's outlier measure and an MDS embedding\n" +
+	"impute = Fill the missing values of the features with missForest and write the data with -output\n" +
+	"stream = Train a forest of Hoeffding trees one row at a time on the rows of -data, - for stdin, predicting every row before learning it\n" +
+	"isolation = Score every row of the data for anomalies with an Isolation Forest, tree_depth 0 for the default depth\n" +
+	"export = Write a tree of a saved model as a Graphviz dot graph or as if/else rules\n" +
+	"monotone = Check that the predictions of a saved model respect its monotonic constraints, or those of -monotone\n" +
 	"run_mode = (s) - serial, (bal) - WorkBalancing, (stl) - WorkStealing \n" +
-	"tree_num = number of trees in the forest \n" +
+	"tree_num = number of trees in the forest, or the most rounds of boosting with -boost \n" +
 	"tree_depth     = Max depth of the tree\n" +
 	"threads = Runs the parallel version of the program with the specified number of threads.\n" +
 	"threshold = The number of items that a goroutine in the pool can grab from the executor in one time period\n" +
-	"thresholdBalance = The threshold used to know when to perform balancing\n"
+	"thresholdBalance = The threshold used to know when to perform balancing\n" +
+	"options:\n" +
+	"  -data file = The dataset to read, ./randomforest/arrhythmia.csv by default\n" +
+	"  -format name = The format of the dataset, csv or libsvm, guessed from the file extension by default\n" +
+	"  -header = The first row of the dataset holds the column names\n" +
+	"  -delimiter char = The character separating the values: comma, tab, semicolon or any single character\n" +
+	"  -label column = Name or index of the column holding the y variable, the last column by default\n" +
+	"  -monotone list = Comma separated column:direction pairs, 1 if the prediction may only go up as the column grows and -1 if it may only go down, with -regression or -boost\n" +
+	"  -outputs list = Comma separated names or indices of more y variables, predicted with the label by one multi-output forest\n" +
+	"  -unlabeled = With isolation or impute, the dataset has no y variable\n" +
+	"  -select list = Comma separated names or indices of the only feature columns to use\n" +
+	"  -drop list = Comma separated names or indices of the feature columns to leave out\n" +
+	"  -categorical list = Comma separated names or indices of the columns to treat as categorical\n" +
+	"  -weight column = Name or index of the column holding the weight of each row\n" +
+	"  -class_weight spec = Weigh the rows by their class: balanced, or a list of class:weight pairs\n" +
+	"  -float32 = Store the feature values as float32 to halve the memory used\n" +
+	"  -progress = Print the progress of reading the dataset\n" +
+	"  -report = Print the precision and recall of every class\n" +
+	"  -output file = Write the actual and predicted labels of the test data to a csv, with impute the imputed data\n" +
+	"  -save file = Save the trained forest as a json model\n" +
+	"  -importance n = Print the n most important features by mean decrease in impurity, all of them if n < 0\n" +
+	"  -min_samples_split n = The number of rows a node needs to be split, 2 by default\n" +
+	"  -min_samples_leaf n = The number of rows each child of a split needs, 1 by default\n" +
+	"  -min_impurity_decrease x = The decrease in entropy, weighted by the fraction of the rows reaching the node, a split must bring\n" +
+	"  -max_leaf_nodes n = Grow each tree best-first up to n leaves, no limit by default, 1000 by default with stream\n" +
+	"  -ccp_alpha x = Prune each tree with minimal cost-complexity pruning at alpha x\n" +
+	"  -ccp_cv k = Choose the alpha to prune each tree with by k-fold cross validation\n" +
+	"  -ccp_path = Print the cost-complexity pruning path of an unpruned tree grown with the settings of the forest\n" +
+	"  -bootstrap = Train each tree on a bootstrap sample of the training rows and print the out-of-bag accuracy\n" +
+	"  -oob_curve file = With -bootstrap, write the out-of-bag error after every number of trees to a csv\n" +
+	"  -seed n = The seed every random number of the run is drawn from, the split of the data, the trees, the shuffles and the folds, random by default\n" +
+	"  -model file = Score a forest saved with -save on the test rows of the same data instead of training one, with its calibration if it has one\n" +
+	"  -warm_start file = Add tree_num trees to a saved forest trained on the same data, with its settings, and print the out-of-bag error curve\n" +
+	"  -extra_trees = Grow extremely randomized trees, splitting every candidate column at a single random point\n" +
+	"  -balanced spec = Draw the bootstrap sample of every tree by class: under, over, a number of rows per class or class:rows pairs\n" +
+	"  -regression = Train a regression forest predicting the label as a number\n" +
+	"  -quantiles list = With -regression, keep the training values in the leaves and write these comma separated quantiles of every prediction\n" +
+	"  -boost = Train gradient boosted trees instead of a random forest\n" +
+	"  -loss name = With -boost, the loss: log (logistic or softmax) or squared for labels that are numbers, log by default\n" +
+	"  -learning_rate x = With -boost, the factor shrinking the output of every tree, 0.1 by default\n" +
+	"  -subsample x = With -boost, the fraction of the training rows every round is fitted on, 1 by default\n" +
+	"  -early_stopping n = With -boost, stop after n rounds without a better loss on the validation rows\n" +
+	"  -validation x = With -early_stopping, the fraction of the training rows held out for validation, 0.1 by default\n" +
+	"  -calibrate method = Calibrate the class probabilities with platt or isotonic, on the out-of-bag rows or on -calibration_holdout rows, and print the Brier score on the test data before and after\n" +
+	"  -calibration_holdout x = With -calibrate, hold out the fraction x of the training rows to fit the calibration on instead of the out-of-bag rows\n" +
+	"  -reliability file = With -calibrate, write the reliability diagram of the test data before and after calibration to a csv\n" +
+	"  -bins n = With -reliability, the number of bins of the probabilities, 10 by default\n" +
+	"  -permutation n = Print the n most important features by permutation importance, all of them if n < 0\n" +
+	"  -repeats r = The number of times each feature is shuffled for the permutation importance, 5 by default\n" +
+	"  -oob = Compute the permutation importance on the out-of-bag rows instead of the test data\n" +
+	"  -prox_rows set = With proximity, the rows to compare: train, test or all, train by default\n" +
+	"  -mds file = With proximity, write the MDS embedding of the rows with their outlier measure to a csv\n" +
+	"  -dims k = With proximity, the number of dimensions of the MDS embedding, 2 by default\n" +
+	"  -prox_out file = With proximity, write the proximity matrix to a csv\n" +
+	"  -max_iter n = With impute, the most iterations of missForest, 10 by default\n" +
+	"  -follow = With stream, wait for more rows at the end of the file as tail -f does\n" +
+	"  -grace n = With stream, the rows a leaf sees between two attempts to split it, 200 by default\n" +
+	"  -delta x = With stream, the probability of a Hoeffding tree splitting on the wrong column, 1e-7 by default\n" +
+	"  -tie x = With stream, split on the best column anyway once the Hoeffding bound is under x, 0.05 by default\n" +
+	"  -batch n = With stream, the number of rows the trees learn at once on the executor, 1 by default\n" +
+	"  -report_every n = With stream, print the accuracy every n rows and save the model with -save, 1000 by default\n" +
+	"  -max_samples n = With isolation, the number of rows each tree is grown on, 256 by default\n" +
+	"  -contamination x = With isolation, the share of the rows flagged as anomalies, the rows scoring above 0.5 by default\n" +
+	"  -top k = With explain, the number of features printed for each row, with isolation or proximity the number of top anomalies or outliers, 5 by default\n" +
+	"  -rows n = With explain or path, the number of test rows explained, all of them by default\n"
 
 // Node to store the attributes related to a decision Tree
 type DNode struct {
@@ -27,20 +102,82 @@ type DNode struct {
 	// If the node is a leaf node
 	nodeType string
 
-	// The class predicted by the node
+	// The class predicted by the node, or the value it predicts in a
+	// regression tree
 	predictedClass float64
-	X              [][]float64
+
+	// The number of training rows reaching the node, their total weight,
+	// their entropy (their variance in a regression tree) and the weight of
+	// them in each class, nil in a regression tree
+	nSamples     int
+	weight       float64
+	impurity     float64
+	distribution map[float64]float64
 
 	// Which attribute is the node testing on
 	testAttribute int
 	testValue     float64
 	children      []DNode
+
+	// If the attribute is categorical, the categories going to the left child
+	categorical    bool
+	leftCategories map[float64]bool
+
+	// The y values of the training rows reaching a leaf of a quantile
+	// regression forest, with their weights
+	values       []float64
+	valueWeights []float64
+
+	// The prediction of every output in a multi-output tree, nil otherwise
+	outputs []float64
 }
 
 // The tree class to implement decision Tree
 type Tree struct {
 	maxDepth int
 	root     DNode
+
+	// Stopping rules: the rows needed to split a node, the rows needed in
+	// each child, the weighted decrease in impurity a split must bring and
+	// the number of leaves to grow best-first (no limit if 0)
+	minSamplesSplit     int
+	minSamplesLeaf      int
+	minImpurityDecrease float64
+	maxLeafNodes        int
+
+	// The total weight of the rows the tree is trained on
+	wTotal float64
+
+	// The weight of every row of the data, nil if the rows weigh the same
+	weights []float64
+
+	// The columns of the data the tree is allowed to split on
+	features []int
+
+	// Which of the columns of the data are categorical
+	categorical []bool
+
+	// The rows of the data left out of the bootstrap sample of the tree
+	oob []int
+
+	// If every candidate column is split at a single random point, as in
+	// extremely randomized trees, instead of at its best point
+	extraTrees bool
+
+	// If the tree predicts the mean of the y values of the rows in its leaves
+	// and splits them to reduce their variance, instead of their entropy
+	regression bool
+
+	// If the leaves of a regression tree keep the y values of their rows
+	keepValues bool
+
+	// The monotonic constraint of every column of the data, nil if none
+	monotone []int
+
+	// The seed of the random numbers drawn to grow the tree and the
+	// generator drawing them
+	seed int64
+	rng  *rand.Rand
 }
 
 // Struct to help in ArgSort
@@ -55,88 +192,144 @@ func (s Slice) Swap(i, j int) {
 	s.idx[i], s.idx[j] = s.idx[j], s.idx[i]
 }
 
-// Method of class Tree to fit the decision tree
-func (T *Tree) fit(X [][]float64, y []float64) {
-	T.root = T.recursiveBuildTree(X, y, 0)
+// Method of class Tree to fit the decision tree on the rows idx of the data
+func (T *Tree) fit(X Matrix, y []float64, idx []int) {
+	T.wTotal = sum(T.rowWeights(idx))
+	if T.maxLeafNodes > 0 {
+		T.root = T.bestFirstBuildTree(X, y, idx)
+	} else {
+		T.root = T.recursiveBuildTree(X, y, idx, 0)
+	}
 }
 
 // Method of class Tree to build the decision tree
-func (T *Tree) recursiveBuildTree(X [][]float64, y []float64, currDepth int) DNode {
-	node := DNode{}
-	node.X = X
+func (T *Tree) recursiveBuildTree(X Matrix, y []float64, idx []int, currDepth int) DNode {
+	node := T.leafNode(y, idx)
+	if node.nSamples == 0 {
+		return node
+	}
 
-	// Finding frequency of each element
-	m := findFreq(y, 1.0)
+	// Deciding the attribute and on which point to divide the attribute
+	split := T.findSplit(X, y, idx, currDepth, &node)
+	if split == nil {
+		return node
+	}
+	node.setSplit(split)
+	node = T.nodeChildren(X, y, idx, currDepth, node)
+	return node
+}
 
-	rows := len(X)
+// Function to create a leaf node for the rows idx of the data
+func (T *Tree) leafNode(y []float64, idx []int) DNode {
+	node := DNode{nodeType: "leaf"}
+	rows := len(idx)
 	if rows == 0 {
 		// Sending a random number in case we want to predict the parent class
 		node.predictedClass = -0.123
 		return node
 	}
-	cols := len(X[0])
-
-	ctr := true
-
-	// Checking if all Xs are the same
-	for i := 0; i < rows; i++ {
-		for j := 1; j < cols; j++ {
-			if X[i][0] != X[i][j] {
-				ctr = false
-				break
-			}
-		}
-		if ctr == false {
-			break
+	yNode := pick(y, idx)
+	w := T.rowWeights(idx)
+
+	node.nSamples = rows
+	node.weight = sum(w)
+	if T.regression {
+		node.impurity = variance(yNode, w)
+		node.predictedClass = weightedMean(yNode, w)
+		if T.keepValues {
+			node.values, node.valueWeights = yNode, w
 		}
+		return node
 	}
 
+	// Finding the weight of each class
+	node.distribution = weightedFreq(yNode, w)
+	node.impurity = T.entropy(yNode, w)
+	node.predictedClass = T.classPredict(yNode, w)
+	return node
+}
+
+// Split chosen for a node before its children are built
+type splitCandidate struct {
+	attribute int
+	value     float64
+	leftSet   map[float64]bool
+
+	// The decrease in impurity, weighted by the fraction of the weight of
+	// the rows of the tree reaching the node
+	decrease float64
+
+	// Where the split is to be made, for the best-first growth
+	node  *DNode
+	idx   []int
+	depth int
+}
+
+// Function to find the best split of the rows idx of the data reaching the
+// node, or nil if the node has to stay a leaf
+func (T *Tree) findSplit(X Matrix, y []float64, idx []int, currDepth int, node *DNode) *splitCandidate {
+	rows := len(idx)
+
 	// To check if the current node should be a leaf node
-	if currDepth == T.maxDepth || len(m) <= 1 || ctr {
-		node.nodeType = "leaf"
-		if len(y) != 0 {
-			node.predictedClass = T.classPredict(y)
-		} else {
-			node.predictedClass = -0.123
-		}
-	} else {
+	if currDepth == T.maxDepth || T.isPure(node) || rows < T.minSamplesSplit || rows < 2*T.minSamplesLeaf || T.allSame(X, idx) {
+		return nil
+	}
 
-		// Deciding the attribute and on which point to divide the attribute
-		A, val := T.importance(X, y)
-		node.testAttribute, node.testValue = A, val
-		node = T.nodeChildren(X, y, A, val, currDepth, node)
+	A, val, leftSet, minEntropy := T.importance(X, pick(y, idx), T.rowWeights(idx), idx)
+	if math.IsInf(minEntropy, 1) {
+		return nil
 	}
-	return node
+	decrease := node.weight / T.wTotal * (node.impurity - minEntropy)
+	if decrease < T.minImpurityDecrease {
+		return nil
+	}
+	return &splitCandidate{attribute: A, value: val, leftSet: leftSet, decrease: decrease, idx: idx, depth: currDepth}
 }
 
-// Function to build the children of the dtree
-func (T *Tree) nodeChildren(X [][]float64, y []float64, A int, val float64, currDepth int, node DNode) DNode {
-	var newX1 [][]float64
-	var newY1 []float64
-	var newX2 [][]float64
-	var newY2 []float64
+// Function to check if the rows reaching the node all have the same class,
+// or the same value in a regression tree
+func (T *Tree) isPure(node *DNode) bool {
+	if T.regression {
+		return node.impurity <= 0
+	}
+	return len(node.distribution) <= 1
+}
 
-	n := len(y)
+// Function to turn the node into a split node testing the candidate split
+func (node *DNode) setSplit(split *splitCandidate) {
+	node.nodeType = ""
+	node.testAttribute, node.testValue = split.attribute, split.value
+	if split.leftSet != nil {
+		node.categorical, node.leftCategories = true, split.leftSet
+	}
+}
 
-	// Splitting the data basis the attribute value
-	for i := 0; i < n; i++ {
-		if X[i][A] < val {
-			newX1 = append(newX1, X[i][:])
-			newY1 = append(newY1, y[i])
-		} else {
-			newX2 = append(newX2, X[i][:])
-			newY2 = append(newY2, y[i])
+// Function to check if all the rows have the same value in every column the
+// tree can split on, in which case no split can separate them
+func (T *Tree) allSame(X Matrix, idx []int) bool {
+	for _, j := range T.features {
+		first := X.At(idx[0], j)
+		for _, i := range idx[1:] {
+			if X.At(i, j) != first {
+				return false
+			}
 		}
 	}
+	return true
+}
 
-	nodeLeft := T.recursiveBuildTree(newX1, newY1, currDepth+1)
-	nodeRight := T.recursiveBuildTree(newX2, newY2, currDepth+1)
+// Function to build the children of the dtree
+func (T *Tree) nodeChildren(X Matrix, y []float64, idx []int, currDepth int, node DNode) DNode {
+	newIdx1, newIdx2 := node.partition(X, idx)
+
+	nodeLeft := T.recursiveBuildTree(X, y, newIdx1, currDepth+1)
+	nodeRight := T.recursiveBuildTree(X, y, newIdx2, currDepth+1)
 
 	// Meaning that there was not enough data for the left/right child
 	if nodeLeft.predictedClass == -0.123 && nodeLeft.nodeType == "leaf" {
-		nodeLeft.predictedClass = T.classPredict(y)
+		nodeLeft.predictedClass = node.predictedClass
 	} else if nodeRight.predictedClass == -0.123 && nodeRight.nodeType == "leaf" {
-		nodeRight.predictedClass = T.classPredict(y)
+		nodeRight.predictedClass = node.predictedClass
 	}
 	node.children = append(node.children, nodeLeft)
 	node.children = append(node.children, nodeRight)
@@ -145,33 +338,104 @@ func (T *Tree) nodeChildren(X [][]float64, y []float64, A int, val float64, curr
 
 }
 
-// Function to predict the class of the given dataset
-func (T *Tree) classPredict(y []float64) float64 {
-	return mostFrequent(y)
+// Function to split the rows idx of the data basis the attribute value
+func (node *DNode) partition(X Matrix, idx []int) ([]int, []int) {
+	var newIdx1 []int
+	var newIdx2 []int
+	for _, i := range idx {
+		if node.goesLeft(X, i) {
+			newIdx1 = append(newIdx1, i)
+		} else {
+			newIdx2 = append(newIdx2, i)
+		}
+	}
+	return newIdx1, newIdx2
 }
 
-// Function to calculate the importance and return the best attribute and the split value
-func (T *Tree) importance(X [][]float64, y []float64) (int, float64) {
+// Function to check if row i of the data goes to the left child of the node
+func (node *DNode) goesLeft(X Matrix, i int) bool {
+	if node.categorical {
+		return node.leftCategories[X.At(i, node.testAttribute)]
+	}
+	return X.At(i, node.testAttribute) < node.testValue
+}
+
+// Function to check if a column of the data is categorical
+func (T *Tree) isCategorical(col int) bool {
+	return col < len(T.categorical) && T.categorical[col]
+}
+
+// Function to predict the class of the given dataset, the class with the
+// largest total weight
+func (T *Tree) classPredict(y []float64, w []float64) float64 {
+	return weightedMostFrequent(y, w)
+}
+
+// Function to calculate the importance and return the best attribute, the split value
+// and the entropy of the split (its variance in a regression tree). For categorical attributes the set of categories going
+// left is returned instead of the split value. w holds the weights of the rows
+func (T *Tree) importance(X Matrix, y []float64, w []float64, idx []int) (int, float64, map[float64]bool, float64) {
 	minEntropy := math.Inf(2)
-	minI := 1
+	minI := T.features[0]
 	minVal := math.Inf(2)
+	var minSet map[float64]bool
 
-	n := len(X[0])
+	for _, i := range T.features {
 
-	for i := 0; i < n; i++ {
+		if T.extraTrees {
+			thisEntropy, val, leftSet := T.importanceRandom(column(X, idx, i), y, w, T.isCategorical(i), T.direction(i))
+			if thisEntropy < minEntropy {
+				minEntropy = thisEntropy
+				minI = i
+				minVal = val
+				minSet = leftSet
+			}
+			continue
+		}
+
+		if T.regression && T.isCategorical(i) {
+			thisEntropy, leftSet := T.importanceCatReg(column(X, idx, i), y, w)
+			if thisEntropy < minEntropy {
+				minEntropy = thisEntropy
+				minI = i
+				minSet = leftSet
+			}
+			continue
+		}
+		if T.regression {
+			thisEntropy, val := T.importanceContReg(column(X, idx, i), y, w, T.direction(i))
+			if thisEntropy < minEntropy {
+				minEntropy = thisEntropy
+				minI = i
+				minVal = val
+				minSet = nil
+			}
+			continue
+		}
+
+		if T.isCategorical(i) {
+			thisEntropy, leftSet := T.importanceCat(column(X, idx, i), y, w)
+			if thisEntropy < minEntropy {
+				minEntropy = thisEntropy
+				minI = i
+				minSet = leftSet
+			}
+			continue
+		}
 
-		thisEntropy, val := T.importanceCont(ColSliceSingle(X, i), y)
+		thisEntropy, val := T.importanceCont(column(X, idx, i), y, w)
 		if thisEntropy < minEntropy {
 			minEntropy = thisEntropy
 			minI = i
 			minVal = val
+			minSet = nil
 		}
 	}
-	return minI, minVal
+	return minI, minVal, minSet, minEntropy
 }
 
 // Helper function to importance
-func (T *Tree) importanceCont(X []float64, y []float64) (float64, float64) {
+func (T *Tree) importanceCont(X []float64, y []float64, w []float64) (float64, float64) {
 
 	// Creating newX and newY, such that the elements in the newX are sorted
 	newX := Slice{
@@ -185,22 +449,33 @@ func (T *Tree) importanceCont(X []float64, y []float64) (float64, float64) {
 	sort.Sort(newX)
 	argsort := newX.idx
 
-	var newY []float64
+	var newY, newW []float64
 	n := len(y)
 	for i := 0; i < n; i++ {
 		newY = append(newY, y[argsort[i]])
+		newW = append(newW, w[argsort[i]])
 	}
 
 	minEntropy := math.Inf(2)
 	val := float64(n - 1)
 
+	// Keeping the class weights on both sides of the split up to date so
+	// that each split point is evaluated without going over the data again
+	left := make(map[float64]float64)
+	right := weightedFreq(newY, newW)
+	total := sum(newW)
+	wLeft := 0.0
+
 	for i := 0; i < n-1; i++ {
-		if X[i] == X[i+1] {
+		left[newY[i]] += newW[i]
+		right[newY[i]] -= newW[i]
+		wLeft += newW[i]
+		if X[i] == X[i+1] || i+1 < T.minSamplesLeaf || n-i-1 < T.minSamplesLeaf || total <= 0 {
 			continue
 		}
 
 		// Returning the split with least entropy
-		thisEntropy := float64(i+1)/float64(n)*T.entropy(newY[:i+1]) + float64(n-i-1)/float64(n)*T.entropy(newY[i+1:])
+		thisEntropy := wLeft/total*entropyCounts(left, wLeft) + (total-wLeft)/total*entropyCounts(right, total-wLeft)
 		if thisEntropy < minEntropy {
 			minEntropy = thisEntropy
 			val = (X[i] + X[i+1]) / 2
@@ -209,15 +484,15 @@ func (T *Tree) importanceCont(X []float64, y []float64) (float64, float64) {
 	return minEntropy, val
 }
 
-// Function to predict the y Value for any unseen data
-func (T *Tree) predict(X [][]float64) []float64 {
+// Function to predict the y Value for the rows idx of any unseen data
+func (T *Tree) predict(X Matrix, idx []int) []float64 {
 
 	var yPred []float64
 
-	for i := 0; i < len(X); i++ {
+	for _, i := range idx {
 		thisNode := T.root
 		for thisNode.nodeType != "leaf" {
-			if X[i][thisNode.testAttribute] < thisNode.testValue {
+			if thisNode.goesLeft(X, i) {
 				thisNode = thisNode.children[0]
 			} else {
 				thisNode = thisNode.children[1]
@@ -229,39 +504,59 @@ func (T *Tree) predict(X [][]float64) []float64 {
 	return yPred
 }
 
-// Function to calculate the Entropy. The node is split wherever the entropy is least
-func (T *Tree) entropy(y []float64) float64 {
+// Function to calculate the Entropy of the rows with weights w. The node is
+// split wherever the entropy is least
+func (T *Tree) entropy(y []float64, w []float64) float64 {
+	return entropyCounts(weightedFreq(y, w), sum(w))
+}
+
+// Running count of the votes for the classes of a row. The winner is the
+// first class to reach the most votes
+type voteCount struct {
+	counts map[float64]int
+	best   float64
+	most   int
+}
 
-	n := float64(len(y))
-	m := findFreq(y, n)
-	sum := 0.0
-	for _, value := range m {
-		sum -= math.Log2(value) * value
+// Function to add a vote for the class
+func (v *voteCount) add(class float64) {
+	if v.counts == nil {
+		v.counts = make(map[float64]int)
+	}
+	v.counts[class]++
+	if v.counts[class] > v.most {
+		v.most = v.counts[class]
+		v.best = class
 	}
-	return sum
 }
 
-// Function to create a map with frequency of each element in the list
-func findFreq(y []float64, div float64) map[float64]float64 {
+// Function to return the element occuring most frequently in a given array,
+// the first one to reach it on ties
+func mostFrequent(arr []float64) float64 {
+	var v voteCount
+	for _, a := range arr {
+		v.add(a)
+	}
+	return v.best
+}
+
+// Function to create a map with the total weight of each element in the list
+func weightedFreq(y []float64, w []float64) map[float64]float64 {
 	m := make(map[float64]float64)
-	for _, i := range y {
-		_, ok := m[i]
-		if ok {
-			m[i] += 1.0 / div
-		} else {
-			m[i] = 1.0 / div
-		}
+	for k, i := range y {
+		m[i] += w[k]
 	}
 	return m
 }
 
-// Function to return the element occuring most frequently in a given array
-func mostFrequent(arr []float64) float64 {
-	m := map[float64]int{}
-	var maxCnt int
+// Function to return the element with the largest total weight in a given
+// array, the first one to reach it on ties
+func weightedMostFrequent(arr []float64, w []float64) float64 {
+	m := map[float64]float64{}
+	maxCnt := math.Inf(-1)
 	var freq float64
-	for _, a := range arr {
-		m[a]++
+	for k, a := range arr {
+		m[a] += w[k]
 		if m[a] > maxCnt {
 			maxCnt = m[a]
 			freq = a
@@ -272,71 +567,52 @@ func mostFrequent(arr []float64) float64 {
 
 // Creating a struct to hold all variables to be passed for parallelising the algorithm
 type IntervalTask struct {
-	XTrain   [][]float64
-	XTest    [][]float64
-	yTrain   []float64
-	cols     int
-	sqrtCols int
-	rows     int
-	i        int
+	X      Matrix
+	y      []float64
+	train  []int
+	config *ForestConfig
+	seed   int64
 }
 
-// The function to perform computation for each thread
-func calculateIntervals(XTrain [][]float64, XTest [][]float64, yTrain []float64, cols int, sqrtCols int, rows int, i int) []float64 {
-	thisCols := rand.Perm(cols - 1)[:sqrtCols]
-	var XTrainTemp [][]float64
-	var XTestTemp [][]float64
-
-	XTrainTemp = ColSlice2(XTrain, thisCols)
-
-	XTestTemp = ColSlice2(XTest, thisCols)
-
-	tree := Tree{maxDepth: i}
-	tree.fit(XTrainTemp, yTrain)
+// The function to perform computation for each thread. The tree is trained
+// on the rows train of the data, or on a bootstrap sample of them that may be
+// stratified by class, with some of the columns picked at random. Every
+// random number drawn comes from the seed, so the same seed grows the same tree
+func calculateIntervals(X Matrix, y []float64, train []int, config *ForestConfig, seed int64) *Tree {
+	rng := rand.New(rand.NewSource(seed))
+	tree := config.newTree(config.pickColumns(rng, X.Cols()), seed)
+	tree.rng = rng
+	if config.classCounts != nil {
+		var sample []int
+		sample, tree.oob = balancedSample(train, y, config.classCounts, rng)
+		tree.fit(X, y, sample)
+	} else if config.bootstrap {
+		var sample []int
+		sample, tree.oob = bootstrapSample(train, rng)
+		tree.fit(X, y, sample)
+	} else {
+		tree.fit(X, y, train)
+	}
+	if config.ccpAlpha > 0 {
+		tree.prune(config.ccpAlpha)
+	}
+	tree.boundValues()
 
-	return tree.predict(XTestTemp)
+	return tree
 }
 
-// Creating a callable for our Executor
-func NewIntervalTask(XTrain [][]float64, XTest [][]float64, yTrain []float64, cols int, sqrtCols int, rows int, i int) concurrent.Callable {
-	return &IntervalTask{XTrain, XTest, yTrain, cols, sqrtCols, rows, i}
+// Creating a callable for our Executor, growing the tree from the given seed
+func NewSeededTask(X Matrix, y []float64, train []int, config *ForestConfig, seed int64) concurrent.Callable {
+	return &IntervalTask{X, y, train, config, seed}
 }
 
 // Defining the Call function for the Executor
 func (task *IntervalTask) Call() interface{} {
 
-	yPred := calculateIntervals(task.XTrain, task.XTest, task.yTrain, task.cols, task.sqrtCols, task.rows, task.i)
-
-	return yPred
-
-}
+	tree := calculateIntervals(task.X, task.y, task.train, task.config, task.seed)
 
-// Creating a function to find a slice of columns
-func ColSlice(Arr [][]float64, from int, to int) [][]float64 {
-	var ArrRet [][]float64
-	rows := len(Arr)
-	for i := 0; i < rows; i++ {
-		var tempData []float64
-		for j := from; j < to; j++ {
-			tempData = append(tempData, Arr[i][j])
-		}
-		ArrRet = append(ArrRet, tempData)
-	}
-	return ArrRet
-}
+	return tree
 
-// Creating a function to find a slice of columns
-func ColSlice2(Arr [][]float64, lst []int) [][]float64 {
-	var ArrRet [][]float64
-	rows := len(Arr)
-	for i := 0; i < rows; i++ {
-		var tempData []float64
-		for _, j := range lst {
-			tempData = append(tempData, Arr[i][j])
-		}
-		ArrRet = append(ArrRet, tempData)
-	}
-	return ArrRet
 }
 
 // Creating a function to find a slice of columns
@@ -352,10 +628,7 @@ func ColSliceSingle(Arr [][]float64, col int) []float64 {
 // Function to print accuracy of the Random Forest
 func Accuracy (yPred [][]float64, yTest []float64) {
 
-	var yPred2 []float64
-	for j := 0; j < len(yPred[0]); j++ {
-		yPred2 = append(yPred2, mostFrequent(ColSliceSingle(yPred, j)))
-	}
+	yPred2 := Vote(yPred)
 
 	acc := 0
 	for j := 0; j < len(yTest); j++ {
@@ -367,114 +640,649 @@ func Accuracy (yPred [][]float64, yTest []float64) {
 	fmt.Println(float64(acc) / float64(len(yTest)))
 }
 
-// Function to split the data into train and test
-func TrainTestSplit (rows int, cols int, data2 [][]float64) ([][]float64, [][]float64, []float64, []float64) {
-
-	X := ColSlice(data2, 0, cols-1)
-	y := ColSliceSingle(data2, cols-1)
+// Function to split the rows of the data into train and test, the same way
+// for the same seed
+func TrainTestSplit (rows int, seed int64) ([]int, []int) {
 
-	randList := rand.Perm(rows)
-	var XTrain [][]float64
-	var yTrain []float64
-	var XTest [][]float64
-	var yTest []float64
+	randList := rand.New(rand.NewSource(seed)).Perm(rows)
+	return randList[:rows*2/3], randList[rows*2/3:]
+}
 
-	for i := 0; i < rows*2/3; i++ {
-		XTrain = append(XTrain, X[randList[i]][:])
-		yTrain = append(yTrain, y[randList[i]])
+// Function to create the executor of the run mode from its arguments. The
+// serial version runs the tasks without an executor
+func newExecutor(implementationType string, args []string) concurrent.ExecutorService {
+	if implementationType == "s" {
+		return nil
 	}
-
-	for i := rows * 2 / 3; i < rows; i++ {
-		XTest = append(XTest, X[randList[i]][:])
-		yTest = append(yTest, y[randList[i]])
+	threadCount, _ := strconv.Atoi(args[4])
+	threshold, _ := strconv.Atoi(args[5])
+	if implementationType == "bal" {
+		thresholdBalance, _ := strconv.Atoi(args[6])
+		return concurrent.NewWorkBalancingExecutor(threadCount, threshold, thresholdBalance)
 	}
-	return XTrain, XTest, yTrain, yTest
+	return concurrent.NewWorkStealingExecutor(threadCount, threshold)
 }
 
-// Function to read the data and preprocess it
-func ReadPreProcess(str string) ([][]float64, int, int) {
-	f, err := os.Open(str)
+func main() {
+
+	// The subcommand, if any, comes before the run mode
+	args := os.Args
+	if len(args) > 1 && args[1] == "export" {
+		runExport(args[2:])
+		return
+	}
+	if len(args) > 1 && args[1] == "monotone" {
+		runMonotone(args[2:])
+		return
+	}
+	command := ""
+	if len(args) > 1 && (args[1] == "explain" || args[1] == "path" || args[1] == "isolation" || args[1] == "proximity" || args[1] == "impute" || args[1] == "stream") {
+		command = args[1]
+		args = args[1:]
+	}
+	
+	if len(args) < 4 {
+		fmt.Print(usage)
+		return
+	}
+
+	implementationType := args[1]
+	trees, _ := strconv.Atoi(args[2])
+	i, _ := strconv.Atoi(args[3])
+
+	// The options come after the positional arguments of the run mode
+	nArgs := 4
+	if implementationType == "stl" {
+		nArgs = 6
+	} else if implementationType == "bal" {
+		nArgs = 7
+	}
+	if len(args) < nArgs {
+		fmt.Print(usage)
+		return
+	}
+	fs := flag.NewFlagSet("randomforest", flag.ExitOnError)
+	dataPath := fs.String("data", "./randomforest/arrhythmia.csv", "the dataset to read")
+	format := fs.String("format", "", "the format of the dataset, csv or libsvm")
+	header := fs.Bool("header", false, "the first row of the dataset holds the column names")
+	delimiter := fs.String("delimiter", ",", "the character separating the values")
+	labelCol := fs.String("label", "", "name or index of the label column, the last column if empty")
+	unlabeled := fs.Bool("unlabeled", false, "the dataset has no label column")
+	outputList := fs.String("outputs", "", "comma separated columns of more y variables")
+	monotoneList := fs.String("monotone", "", "comma separated column:direction pairs")
+	selectList := fs.String("select", "", "comma separated feature columns to use")
+	dropList := fs.String("drop", "", "comma separated feature columns to leave out")
+	categoricalList := fs.String("categorical", "", "comma separated categorical columns")
+	weightCol := fs.String("weight", "", "name or index of the column holding the weight of each row")
+	classWeight := fs.String("class_weight", "", "balanced or a list of class:weight pairs")
+	use32 := fs.Bool("float32", false, "store the feature values as float32")
+	progress := fs.Bool("progress", false, "print the progress of reading the dataset")
+	report := fs.Bool("report", false, "print the precision and recall of every class")
+	output := fs.String("output", "", "csv file to write the predicted labels to")
+	savePath := fs.String("save", "", "json file to save the trained forest to")
+	importance := fs.Int("importance", 0, "number of most important features to print")
+	minSamplesSplit := fs.Int("min_samples_split", 2, "number of rows a node needs to be split")
+	minSamplesLeaf := fs.Int("min_samples_leaf", 1, "number of rows each child of a split needs")
+	minImpurityDecrease := fs.Float64("min_impurity_decrease", 0, "weighted decrease in entropy a split must bring")
+	maxLeafNodes := fs.Int("max_leaf_nodes", 0, "number of leaves to grow each tree best-first to")
+	ccpAlpha := fs.Float64("ccp_alpha", 0, "alpha to prune each tree with")
+	ccpCV := fs.Int("ccp_cv", 0, "number of folds to choose the pruning alpha by cross validation")
+	ccpPath := fs.Bool("ccp_path", false, "print the pruning path of an unpruned tree")
+	bootstrap := fs.Bool("bootstrap", false, "train each tree on a bootstrap sample")
+	oobCurve := fs.String("oob_curve", "", "csv file to write the out-of-bag error curve to")
+	seedFlag := fs.Int64("seed", 0, "seed of every random number of the run, random if 0")
+	warmStart := fs.String("warm_start", "", "json model of a forest to add trees to")
+	modelPath := fs.String("model", "", "json model of a forest to score instead of training one")
+	extraTrees := fs.Bool("extra_trees", false, "grow extremely randomized trees")
+	balanced := fs.String("balanced", "", "under, over, a number of rows per class or class:rows pairs")
+	regression := fs.Bool("regression", false, "train a regression forest on the label as a number")
+	quantileList := fs.String("quantiles", "", "comma separated quantiles to find for every prediction")
+	boost := fs.Bool("boost", false, "train gradient boosted trees")
+	loss := fs.String("loss", "log", "log or squared")
+	learningRate := fs.Float64("learning_rate", 0.1, "factor shrinking the output of every boosted tree")
+	subsample := fs.Float64("subsample", 1, "fraction of the training rows every round of boosting is fitted on")
+	earlyStopping := fs.Int("early_stopping", 0, "rounds without a better validation loss before boosting stops")
+	validation := fs.Float64("validation", 0.1, "fraction of the training rows held out for early stopping")
+	calibrate := fs.String("calibrate", "", "platt or isotonic")
+	calibrationHoldout := fs.Float64("calibration_holdout", 0, "fraction of the training rows held out to fit the calibration on")
+	reliability := fs.String("reliability", "", "csv file to write the reliability diagram to")
+	bins := fs.Int("bins", 10, "number of bins of the reliability diagram")
+	permutation := fs.Int("permutation", 0, "number of most important features to print by permutation importance")
+	repeats := fs.Int("repeats", 5, "number of shuffles of each feature for the permutation importance")
+	useOOB := fs.Bool("oob", false, "compute the permutation importance on the out-of-bag rows")
+	proxRows := fs.String("prox_rows", "train", "train, test or all")
+	mdsPath := fs.String("mds", "", "csv file to write the MDS embedding to")
+	dims := fs.Int("dims", 2, "number of dimensions of the MDS embedding")
+	proxOut := fs.String("prox_out", "", "csv file to write the proximity matrix to")
+	follow := fs.Bool("follow", false, "wait for more rows at the end of the stream")
+	grace := fs.Int("grace", 200, "rows a leaf sees between two attempts to split it")
+	delta := fs.Float64("delta", 1e-7, "probability of a Hoeffding tree splitting on the wrong column")
+	tie := fs.Float64("tie", 0.05, "Hoeffding bound under which the best split is taken anyway")
+	batch := fs.Int("batch", 1, "rows the trees of a stream learn at once")
+	reportEvery := fs.Int("report_every", 1000, "rows between two reports of a stream")
+	maxIter := fs.Int("max_iter", 10, "most iterations of missForest")
+	maxSamples := fs.Int("max_samples", 256, "number of rows each isolation tree is grown on")
+	contamination := fs.Float64("contamination", 0, "share of the rows flagged as anomalies")
+	top := fs.Int("top", 5, "number of features printed for each explained row")
+	explainRows := fs.Int("rows", 0, "number of test rows to explain")
+	fs.Parse(args[nArgs:])
+
+	comma, err := ParseDelimiter(*delimiter)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
+	opts := LoadOptions{
+		Header:      *header,
+		Delimiter:   comma,
+		Label:       *labelCol,
+		Unlabeled:   *unlabeled,
+		Select:      SplitList(*selectList),
+		Drop:        SplitList(*dropList),
+		Categorical: SplitList(*categoricalList),
+		Weight:      *weightCol,
+		Outputs:     SplitList(*outputList),
+		Float32:     *use32,
+	}
+	if *progress {
+		opts.Progress = PrintProgress
+	}
+	// A warm start grows the trees with the settings of the saved forest
+	var warm *Forest
+	if *warmStart != "" {
+		if *boost || *balanced != "" || *ccpCV > 1 || *ccpPath || command == "isolation" || command == "impute" {
+			log.Fatal("-warm_start cannot be used with -boost, -balanced, -ccp_cv, -ccp_path, isolation or impute")
+		}
+		if warm, err = LoadForest(*warmStart); err != nil {
+			log.Fatal(err)
+		}
+		if warm.boost != nil {
+			log.Fatal("trees can only be added to a random forest, not to boosted trees")
+		}
+		*regression, *bootstrap = warm.isRegression(), warm.config.bootstrap
 
-	csvReader := csv.NewReader(f)
-	data, err := csvReader.ReadAll()
+		// The new trees weigh the rows as the saved ones did
+		if (*weightCol != "" && *weightCol != warm.config.weightColumn) || (*classWeight != "" && *classWeight != warm.config.classWeight) {
+			log.Fatalf("the saved forest was trained with -weight %q and -class_weight %q, a warm start cannot weigh the rows differently", warm.config.weightColumn, warm.config.classWeight)
+		}
+		opts.Weight, *classWeight = warm.config.weightColumn, warm.config.classWeight
+	}
 
+	// A saved forest is scored on the test rows of its data instead of
+	// training one
+	var saved *Forest
+	if *modelPath != "" {
+		if *warmStart != "" || *boost || *balanced != "" || *ccpCV > 1 || *ccpPath || *calibrate != "" || *savePath != "" || *oobCurve != "" || *monotoneList != "" || len(opts.Outputs) > 0 || command == "isolation" || command == "impute" || command == "stream" {
+			log.Fatal("-model cannot be used with -warm_start, -boost, -balanced, pruning, -calibrate, -save, -oob_curve, -monotone, -outputs, isolation, impute or stream")
+		}
+		if saved, err = LoadForest(*modelPath); err != nil {
+			log.Fatal(err)
+		}
+		if len(saved.outputs) > 0 || (saved.boost != nil && command == "explain") {
+			log.Fatal("-model cannot score a multi-output forest, or explain boosted trees")
+		}
+		*regression = saved.boost == nil && saved.isRegression()
+		*bootstrap = saved.boost == nil && saved.config.bootstrap
+	}
+	if *boost && (*bootstrap || *balanced != "" || *ccpCV > 1 || *ccpPath || command == "explain") {
+		log.Fatal("-boost cannot be used with -bootstrap, -balanced, -ccp_cv, -ccp_path or explain")
+	}
+	if *boost && *loss == "squared" && *report {
+		log.Fatal("-report needs classes, not the squared loss")
+	}
+	if *regression && (*boost || *balanced != "" || *ccpCV > 1 || *report || command == "explain") {
+		log.Fatal("-regression cannot be used with -boost, -balanced, -ccp_cv, -report or explain")
+	}
+	qs, err := ParseQuantiles(*quantileList)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if qs != nil && !*regression {
+		log.Fatal("-quantiles needs -regression")
+	}
+	if *unlabeled && command != "isolation" && command != "impute" {
+		log.Fatal("-unlabeled needs isolation or impute")
+	}
+	if *balanced != "" {
+		*bootstrap = true
+	}
+	if *useOOB && !*bootstrap {
+		log.Fatal("-oob needs -bootstrap")
+	}
+	if *oobCurve != "" && !*bootstrap {
+		log.Fatal("-oob_curve needs -bootstrap")
+	}
+	if len(opts.Outputs) > 0 && (*boost || *balanced != "" || *ccpCV > 1 || *ccpPath || *ccpAlpha > 0 || *extraTrees || *maxLeafNodes > 0 || qs != nil || *calibrate != "" || *classWeight != "" || *warmStart != "" || *oobCurve != "" || *permutation != 0 || *report || command != "") {
+		log.Fatal("-outputs cannot be used with -boost, -balanced, pruning, -extra_trees, -max_leaf_nodes, -quantiles, -calibrate, -class_weight, -warm_start, -oob_curve, -permutation, -report or a command")
+	}
+	if *monotoneList != "" && (!(*regression || *boost) || qs != nil || len(opts.Outputs) > 0 || *warmStart != "" || command == "isolation" || command == "impute" || command == "stream") {
+		log.Fatal("-monotone needs -regression or -boost, and cannot be used with -quantiles, -outputs, -warm_start, isolation, impute or stream")
+	}
+	if *calibrate != "" && (*regression || (*boost && *loss == "squared")) {
+		log.Fatal("-calibrate needs classes, not -regression or the squared loss")
+	}
+	if *classWeight != "" && (*regression || (*boost && *loss == "squared")) {
+		log.Fatal("-class_weight needs classes, not -regression or the squared loss")
+	}
+	if *calibrate != "" && *calibrationHoldout <= 0 && !*bootstrap {
+		log.Fatal("-calibrate needs -bootstrap or -calibration_holdout")
+	}
+	if *contamination < 0 || *contamination >= 1 {
+		log.Fatal("-contamination must be between 0 and 1, or 0 for the default threshold")
+	}
+	if *repeats < 1 {
+		log.Fatal("-repeats must be at least 1")
+	}
+	if *bins < 1 {
+		log.Fatal("-bins must be at least 1")
+	}
+	if (*calibrationHoldout > 0 || *reliability != "") && *calibrate == "" {
+		log.Fatal("-calibration_holdout and -reliability need -calibrate")
+	}
 
-	var data2 [][]float64
-	rows := len(data)
-	cols := len(data[0])
-
-	// Converting values to float and putting 0 wherever the data is missing
-	for i := 0; i < rows; i++ {
-		var tempData []float64
-		for j := 0; j < cols; j++ {
-			thisFloat, error1 := strconv.ParseFloat(data[i][j], 64)
-			if error1 != nil {
-				thisFloat = 0
+	// A stream is learnt one row at a time instead of being read as a whole
+	if command == "stream" {
+		if *boost || *regression || *warmStart != "" || *unlabeled {
+			log.Fatal("stream cannot be used with -boost, -regression, -warm_start or -unlabeled")
+		}
+		source := io.Reader(os.Stdin)
+		if *dataPath != "-" {
+			f, err := os.Open(*dataPath)
+			if err != nil {
+				log.Fatal(err)
 			}
-			tempData = append(tempData, thisFloat)
+			defer f.Close()
+			source = f
+		}
+		streamConfig := &StreamConfig{maxDepth: i, grace: float64(*grace), delta: *delta, tie: *tie, maxLeaves: *maxLeafNodes, bins: 10}
+		if streamConfig.maxDepth <= 0 {
+			streamConfig.maxDepth = math.MaxInt32
+		}
+		if streamConfig.maxLeaves <= 0 {
+			streamConfig.maxLeaves = 1000
+		}
+		seed := *seedFlag
+		if seed == 0 {
+			seed = rand.Int63()
 		}
-		data2 = append(data2, tempData)
-	}
-	return data2, rows, cols
-}
 
-func main() {
-	
-	if len(os.Args) < 4 {
-		fmt.Println(usage)
+		// The model is saved at every report, as the stream may never end
+		report := func(stats StreamStats, F *StreamForest) {
+			PrintStreamStats(stats)
+			if *savePath != "" {
+				if err := F.Forest().Save(*savePath); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		strt := time.Now()
+		executor := newExecutor(implementationType, args)
+		if _, err := Stream(executor, source, *follow, opts, trees, streamConfig, seed, *batch, *reportEvery, report); err != nil {
+			log.Fatal(err)
+		}
+		if executor != nil {
+			executor.Shutdown()
+		}
+		fmt.Printf("Time Taken: %.2fs\n", time.Since(strt).Seconds())
 		return
 	}
 
-	implementationType := os.Args[1]
-	trees, _ := strconv.Atoi(os.Args[2])
-	i, _ := strconv.Atoi(os.Args[3])
+	// Regression forests and the squared loss read the label as numbers
+	opts.NumericLabel = *regression || (*boost && *loss == "squared") || (saved != nil && saved.isRegression())
 
 	// Reading, preprocessing and splitting the data into train and test
-	data, rows, cols := ReadPreProcess("./randomforest/arrhythmia.csv")
-	XTrain, XTest, yTrain, yTest := TrainTestSplit(rows, cols, data)
+	ds, err := ReadDataset(*dataPath, *format, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	X, y, cols := ds.X, ds.y, ds.X.Cols()
+	seed := *seedFlag
+	if warm != nil {
+		if err := warm.checkData(ds); err != nil {
+			log.Fatal(err)
+		}
+		seed = warm.seed
+	} else if saved != nil {
+		if err := saved.checkData(ds); err != nil {
+			log.Fatal(err)
+		}
+		seed = saved.seed
+	} else if seed == 0 {
+		seed = rand.Int63()
+	}
+	train, test := TrainTestSplit(X.Rows(), seed)
+
+	// Holding out training rows to fit the calibration on
+	var calibrationRows []int
+	if *calibrationHoldout > 0 {
+		n := int(math.Round(*calibrationHoldout * float64(len(train))))
+		if n < 1 || n >= len(train) {
+			log.Fatalf("a calibration holdout of %g leaves no rows to train or to calibrate", *calibrationHoldout)
+		}
+		train, calibrationRows = train[:len(train)-n], train[len(train)-n:]
+	}
+	yTest := pick(y, test)
+
+	config := &ForestConfig{
+		maxDepth:            i,
+		bootstrap:           *bootstrap,
+		minSamplesSplit:     *minSamplesSplit,
+		minSamplesLeaf:      *minSamplesLeaf,
+		minImpurityDecrease: *minImpurityDecrease,
+		maxLeafNodes:        *maxLeafNodes,
+		ccpAlpha:            *ccpAlpha,
+		weightColumn:        *weightCol,
+		classWeight:         *classWeight,
+		extraTrees:          *extraTrees,
+		regression:          *regression,
+		keepValues:          qs != nil,
+	}
 
-	// To find the number of features to pass to each random forest
-	sqrtCols := int(math.Round(math.Sqrt(float64(cols))))
+	for j := 0; j < cols; j++ {
+		config.categorical = append(config.categorical, ds.columns[j].categorical)
+	}
+	if config.monotone, err = ParseMonotone(*monotoneList, ds.columns); err != nil {
+		log.Fatal(err)
+	}
+	if warm != nil {
+		config = warm.config
+	} else if saved != nil {
+		config = saved.config
+	}
 
-	var yPred [][]float64
+	// The weights of the classes are found from the training rows
+	classWeights, err := ClassWeights(*classWeight, y, train, ds.label)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if classWeights != nil {
+		PrintClassWeights(classWeights, ds.label)
+	}
+	config.weights = SampleWeights(ds.weights, y, classWeights)
+	if *balanced != "" {
+		if config.classCounts, err = ClassSampleCounts(*balanced, y, train, ds.label); err != nil {
+			log.Fatal(err)
+		}
+		PrintClassSampleCounts(config.classCounts, ds.label)
+	}
+
+	// To find the number of features to pass to each random forest
+	config.sqrtCols = int(math.Round(math.Sqrt(float64(cols + 1))))
+	if config.sqrtCols > cols {
+		config.sqrtCols = cols
+	}
 
 	strt := time.Now()
 
-	if implementationType == "s" {
-		for k := 0; k < trees; k++ {
-			yPred = append(yPred, calculateIntervals(XTrain, XTest, yTrain, cols, sqrtCols, rows, i))
+	executor := newExecutor(implementationType, args)
+
+	// The Isolation Forest scores every row and ignores the label
+	if command == "isolation" {
+		rows := make([]int, X.Rows())
+		for k := range rows {
+			rows[k] = k
+		}
+		iso := IsolationFit(executor, X, rows, config.categorical, trees, *maxSamples, i, *contamination, streamSeed(seed, isolationStream))
+		scores := iso.Scores(X, rows)
+		PrintAnomalies(scores, rows, iso.threshold, y, ds.label, *top)
+		if *output != "" {
+			if err := WriteAnomalies(*output, scores, rows, iso.threshold); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if executor != nil {
+			executor.Shutdown()
+		}
+		fmt.Printf("Time Taken: %.2fs\n", time.Since(strt).Seconds())
+		return
+	}
+
+	// missForest fills the missing values and writes the data back out
+	if command == "impute" {
+		steps, err := Impute(executor, ds, trees, config, *maxIter, streamSeed(seed, imputeStream))
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintImputeSteps(steps)
+		if *output != "" {
+			if err := WriteImputed(*output, *dataPath, ds, opts); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if executor != nil {
+			executor.Shutdown()
 		}
+		fmt.Printf("Time Taken: %.2fs\n", time.Since(strt).Seconds())
+		return
+	}
 
-	} else {
+	// A multi-output forest predicts the label and the other outputs at once
+	if len(ds.outputs) > 0 {
+		forest := &Forest{columns: ds.columns, label: ds.label, config: config, seed: seed, rows: X.Rows()}
+		forest.outputs = append([]Column{ds.label}, ds.outputs...)
+		Y := append([][]float64{y}, ds.outputY...)
+		forest.trees = MultiOutputFit(executor, X, Y, train, config, trees, seed)
+		pred := forest.PrintOutputScores(X, Y, test)
+		if *bootstrap {
+			forest.PrintOOBOutputScores(X, Y)
+		}
+		if *output != "" {
+			if err := forest.WriteOutputPredictions(*output, Y, test, pred); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *importance != 0 {
+			PrintImportances(forest.FeatureImportances(), ds.columns, *importance)
+		}
+		if *savePath != "" {
+			if err := forest.Save(*savePath); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if executor != nil {
+			executor.Shutdown()
+		}
+		fmt.Printf("Time Taken: %.2fs\n", time.Since(strt).Seconds())
+		return
+	}
 
-		threadCount, _ := strconv.Atoi(os.Args[4])
-		threshold, _ := strconv.Atoi(os.Args[5])
-		executor := concurrent.NewWorkStealingExecutor(threadCount, threshold)
-		if implementationType == "bal" {
-			thresholdBalance, _ := strconv.Atoi(os.Args[6])
-			executor = concurrent.NewWorkBalancingExecutor(threadCount, threshold, thresholdBalance)
+	if *ccpPath {
+		grow := *config
+		grow.ccpAlpha = 0
+		PrintPruningPath(calculateIntervals(X, y, train, &grow, streamSeed(seed, pruneStream)).PruningPath())
+	}
+	if *ccpCV > 1 {
+		if *ccpCV > len(train) {
+			log.Fatalf("-ccp_cv of %d folds for %d training rows leaves empty folds", *ccpCV, len(train))
 		}
-		var futures []concurrent.Future
+		alphas, scores := []float64(nil), []float64(nil)
+		config.ccpAlpha, alphas, scores = SelectAlphaCV(executor, X, y, train, config, *ccpCV, streamSeed(seed, pruneStream))
+		fmt.Printf("%-12s %12s\n", "alpha", "cv accuracy")
+		for k := range alphas {
+			fmt.Printf("%-12.6f %12.4f\n", alphas[k], scores[k])
+		}
+		fmt.Printf("Chosen alpha: %g\n", config.ccpAlpha)
+	}
+
+	var forest *Forest
+	if saved != nil {
+		forest = saved
+		fmt.Printf("Model: %d trees\n", len(forest.trees))
+	} else if *boost {
+		boostConfig := &BoostConfig{loss: *loss, rounds: trees, learningRate: *learningRate, subsample: *subsample, earlyStopping: *earlyStopping, validation: *validation}
+		var validLoss []float64
+		forest, validLoss, err = GradientBoost(executor, X, y, train, config, boostConfig, ds.columns, ds.label, streamSeed(seed, boostStream))
+		if err != nil {
+			log.Fatal(err)
+		}
+		forest.seed, forest.rows = seed, X.Rows()
+		rounds := len(forest.trees) / boostOutputs(forest.boost.loss, len(ds.label.levels))
+		if len(validLoss) > 0 {
+			fmt.Printf("Boosting rounds: %d of %d, validation loss: %.4f\n", rounds, len(validLoss), validLoss[rounds-1])
+		} else {
+			fmt.Printf("Boosting rounds: %d\n", rounds)
+		}
+	} else {
+		// The new trees of a warm start get the seeds after those of the
+		// saved trees
+		forest = &Forest{columns: ds.columns, label: ds.label, config: config, seed: seed, rows: X.Rows()}
+		if warm != nil {
+			forest = warm
+		}
+		first := len(forest.trees)
+		var tasks []concurrent.Callable
 		for k := 0; k < trees; k++ {
-			futures = append(futures, executor.Submit(NewIntervalTask(XTrain, XTest, yTrain, cols, sqrtCols, rows, i)))
+			tasks = append(tasks, NewSeededTask(X, y, train, config, treeSeed(seed, first+k)))
+		}
+		for _, result := range runTasks(executor, tasks) {
+			forest.trees = append(forest.trees, result.(*Tree))
 		}
+		if warm != nil {
+			fmt.Printf("Trees: %d saved + %d new\n", first, trees)
 
-		for _, future := range futures {
-			yPred = append(yPred, future.Get().([]float64))
+			// The calibration of the saved trees does not fit the new forest
+			forest.calibration = nil
 		}
-		executor.Shutdown()
+		if *bootstrap && (warm != nil || *oobCurve != "") {
+			curve := forest.OOBCurve(X, y)
+			PrintOOBCurve(curve, first)
+			if *oobCurve != "" {
+				if err := WriteOOBCurve(*oobCurve, curve); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+
+	// The calibration is fitted before the forest is saved, to be saved with it
+	if *calibrate != "" {
+		rows, fractions := calibrationRows, [][]float64(nil)
+		if rows == nil {
+			rows, fractions = forest.oobFractions(X)
+		} else {
+			fractions = forest.voteFractions(X, rows)
+		}
+		if forest.calibration, err = FitCalibration(*calibrate, fractions, pick(y, rows), len(ds.label.levels)); err != nil {
+			log.Fatal(err)
+		}
+		before := forest.voteFractions(X, test)
+		after := forest.calibration.apply(before)
+		fmt.Printf("Brier score: %.4f before calibration, %.4f after\n", BrierScore(before, yTest), BrierScore(after, yTest))
+		if *reliability != "" {
+			if err := WriteReliability(*reliability, before, after, yTest, ds.label, *bins); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	yPred := forest.predict(X, test)
+	if *savePath != "" {
+		if err := forest.Save(*savePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Regression forests and the squared loss predict the values of the
+	// label instead of classes
+	if forest.isRegression() {
+		yPred2, yTrue := forest.predictions(X, test), yTest
+		rmse, r2 := RegressionScores(yPred2, yTrue)
+		fmt.Printf("RMSE: %v\nR2: %v\n", rmse, r2)
+		var quantiles [][]float64
+		if qs != nil {
+			quantiles = forest.QuantileRows(executor, X, test, qs)
+			PrintIntervalCoverage(quantiles, qs, yTrue)
+		}
+		if *output != "" && qs != nil {
+			err = WriteQuantilePredictions(*output, yPred2, yTrue, qs, quantiles)
+		} else if *output != "" {
+			err = WriteRegressionPredictions(*output, yPred2, yTrue)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		// To check if the code is running properly. Commenting it because we only want the time in output
+		Accuracy(yPred, yTest)
+		if saved != nil {
+			fmt.Printf("Brier score: %.4f\n", BrierScore(forest.probabilities(X, test), yTest))
+		}
+	}
+	if *bootstrap && forest.isRegression() {
+		fmt.Printf("OOB R2: %v\n", forest.oobScore(X, y))
+	} else if *bootstrap {
+		fmt.Printf("OOB Accuracy: %v\n", forest.oobScore(X, y))
+	}
 
+	// Reporting the predictions with the original labels of the classes
+	if (*report || *output != "") && !forest.isRegression() {
+		yPred2 := Vote(yPred)
+		if *report {
+			ClassReport(yPred2, yTest, ds.label)
+		}
+		if *output != "" {
+			var probs [][]float64
+			if forest.calibration != nil {
+				probs = forest.probabilities(X, test)
+			}
+			if err := WritePredictions(*output, yPred2, yTest, ds.label, probs); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
-	// To check if the code is running properly. Commenting it because we only want the time in output
-	Accuracy(yPred, yTest)
+	if *importance != 0 {
+		PrintImportances(forest.FeatureImportances(), ds.columns, *importance)
+	}
+	if *permutation != 0 {
+		mean, std := forest.PermutationImportances(executor, X, y, test, *repeats, *useOOB, streamSeed(seed, permutationStream))
+		PrintPermutationImportances(mean, std, ds.columns, *permutation)
+	}
+
+	rows := test
+	if *explainRows > 0 && *explainRows < len(rows) {
+		rows = rows[:*explainRows]
+	}
+	if command == "explain" {
+		PrintExplanations(forest.ExplainRows(executor, X, rows), X, ds.columns, ds.label, *top)
+	}
+	if command == "proximity" {
+		proxIdx := train
+		switch *proxRows {
+		case "test":
+			proxIdx = test
+		case "all":
+			proxIdx = append(append([]int(nil), train...), test...)
+		case "train":
+		default:
+			log.Fatalf("unknown rows %q, expected train, test or all", *proxRows)
+		}
+		chunks := 1
+		if executor != nil {
+			chunks = 16
+		}
+		prox := forest.Proximities(executor, X, proxIdx, chunks)
+		measure := OutlierMeasure(prox, y, proxIdx)
+		PrintOutliers(measure, proxIdx, y, ds.label, *top)
+		if *mdsPath != "" {
+			if err := WriteMDS(*mdsPath, MDS(prox, *dims, streamSeed(seed, mdsStream)), measure, proxIdx, y, ds.label); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *proxOut != "" {
+			if err := WriteProximities(*proxOut, prox, proxIdx); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if command == "path" {
+		for _, row := range rows {
+			PrintDecisionPaths(forest.DecisionPaths(X, row), X, row, ds.columns, ds.label)
+		}
+	}
+
+	if executor != nil {
+		executor.Shutdown()
+	}
 
 	end := time.Since(strt).Seconds()
 	fmt.Printf("Time Taken: %.2fs\n", end)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Function to check that the data is the data the saved forest was trained
+// on, so that more trees can be added to it or it can be scored on the same
+// test rows: the same number of rows, the same columns and the same classes,
+// and a seed to split it the same way
+func (F *Forest) checkData(ds *Dataset) error {
+	if F.seed == 0 || F.rows == 0 {
+		return errors.New("the model was saved without the seed of its split of the data")
+	}
+	if F.rows != ds.X.Rows() {
+		return fmt.Errorf("the model was trained on %d rows, the data has %d", F.rows, ds.X.Rows())
+	}
+	if len(F.columns) != len(ds.columns) {
+		return fmt.Errorf("the model was trained on %d columns, the data has %d", len(F.columns), len(ds.columns))
+	}
+	for j := range F.columns {
+		if F.columns[j].name != ds.columns[j].name || F.columns[j].categorical != ds.columns[j].categorical {
+			return fmt.Errorf("column %d is %q in the model and %q in the data", j, F.columns[j].name, ds.columns[j].name)
+		}
+	}
+	if len(F.label.levels) != len(ds.label.levels) {
+		return fmt.Errorf("the model has %d classes, the data has %d", len(F.label.levels), len(ds.label.levels))
+	}
+	for c := range F.label.levels {
+		if F.label.levels[c] != ds.label.levels[c] {
+			return fmt.Errorf("class %d is %q in the model and %q in the data", c, F.label.levels[c], ds.label.levels[c])
+		}
+	}
+	return nil
+}
+
+// OOBCurve returns the out-of-bag error of the first k trees of the forest
+// for every k: the share of the rows misclassified by the trees that did not
+// see them, or their mean squared error for a regression forest. Rows that
+// every one of the first k trees saw are left out
+func (F *Forest) OOBCurve(X Matrix, y []float64) []float64 {
+	regression := F.isRegression()
+	votes := make(map[int]*voteCount)
+	total := make(map[int]float64)
+	count := make(map[int]int)
+
+	// The rows seen so far in order, so that the errors add up the same way
+	var rows []int
+	curve := make([]float64, len(F.trees))
+	for t, tree := range F.trees {
+		for k, pred := range tree.predict(X, tree.oob) {
+			i := tree.oob[k]
+			if count[i] == 0 {
+				rows = append(rows, i)
+			}
+			count[i]++
+			if regression {
+				total[i] += pred
+			} else {
+				if votes[i] == nil {
+					votes[i] = &voteCount{}
+				}
+				votes[i].add(pred)
+			}
+		}
+		if len(count) == 0 {
+			continue
+		}
+
+		sort.Ints(rows)
+		errSum := 0.0
+		for _, i := range rows {
+			n := count[i]
+			if regression {
+				diff := total[i]/float64(n) - y[i]
+				errSum += diff * diff
+				continue
+			}
+
+			// The class with the most votes, as mostFrequent finds it
+			if votes[i].best != y[i] {
+				errSum++
+			}
+		}
+		curve[t] = errSum / float64(len(count))
+	}
+	return curve
+}
+
+// Function to print the out-of-bag error curve at about 20 numbers of trees,
+// from the first tree added by a warm start if first is positive
+func PrintOOBCurve(curve []float64, first int) {
+	step := len(curve) / 20
+	if step < 1 {
+		step = 1
+	}
+	fmt.Printf("%-8s %12s\n", "trees", "oob error")
+	for t := 0; t < len(curve); t++ {
+		if (t+1)%step == 0 || t == len(curve)-1 || t+1 == first {
+			mark := ""
+			if t+1 == first {
+				mark = "  (saved trees)"
+			}
+			fmt.Printf("%-8d %12.4f%s\n", t+1, curve[t], mark)
+		}
+	}
+}
+
+// Function to write the out-of-bag error after every number of trees to a csv
+func WriteOOBCurve(path string, curve []float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"trees", "oob_error"})
+	for t, v := range curve {
+		w.Write([]string{strconv.Itoa(t + 1), strconv.FormatFloat(v, 'g', 6, 64)})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSaveLoadWeighting(t *testing.T) {
+	X, y, columns := testData(100, 5)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+	tests := []struct {
+		weightColumn, classWeight string
+	}{
+		{},
+		{weightColumn: "w"},
+		{classWeight: "balanced"},
+		{weightColumn: "3", classWeight: "0:2,1:1"},
+	}
+	for _, test := range tests {
+		F := testForest(X, y, columns, classes, &ForestConfig{maxDepth: 3, weightColumn: test.weightColumn, classWeight: test.classWeight}, 1, 1)
+		loaded := saveLoad(t, F)
+		if loaded.config.weightColumn != test.weightColumn || loaded.config.classWeight != test.classWeight {
+			t.Errorf("loaded -weight %q and -class_weight %q, want %q and %q", loaded.config.weightColumn, loaded.config.classWeight, test.weightColumn, test.classWeight)
+		}
+	}
+}
+
+func TestOOBCurveEndsAtOOBScore(t *testing.T) {
+	X, y, columns := testData(200, 5)
+	classes := newLabelColumn("class", []string{"0", "1", "2"})
+
+	// Few trees leave many rows with tied votes
+	for _, trees := range []int{2, 4, 9} {
+		F := testForest(X, y, columns, classes, &ForestConfig{maxDepth: 4, bootstrap: true, sqrtCols: 1}, trees, 9)
+		curve := F.OOBCurve(X, y)
+		if got, want := curve[len(curve)-1], 1-F.oobScore(X, y); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%d trees: the out-of-bag curve ends at %g, want 1 minus the out-of-bag accuracy %g", trees, got, want)
+		}
+	}
+}
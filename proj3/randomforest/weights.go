@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Function to get the weights of the rows idx of the data, all 1 if the
+// tree has no weights
+func (T *Tree) rowWeights(idx []int) []float64 {
+	return weightsOf(T.weights, idx)
+}
+
+// Function to get the weights of the rows idx, all 1 if weights is nil
+func weightsOf(weights []float64, idx []int) []float64 {
+	if weights == nil {
+		w := make([]float64, len(idx))
+		for k := range w {
+			w[k] = 1
+		}
+		return w
+	}
+	return pick(weights, idx)
+}
+
+// Function to add up the values of a slice
+func sum(arr []float64) float64 {
+	total := 0.0
+	for _, v := range arr {
+		total += v
+	}
+	return total
+}
+
+// ClassWeights returns the weight of every class of the label described by
+// spec, from the rows idx of the data. "balanced" weighs each class by the
+// number of rows over the number of classes times the rows of the class, so
+// that every class has the same total weight. Otherwise spec is a comma
+// separated list of class:weight pairs and the classes left out weigh 1.
+// An empty spec returns nil
+func ClassWeights(spec string, y []float64, idx []int, label Column) ([]float64, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	weights := make([]float64, len(label.levels))
+	for c := range weights {
+		weights[c] = 1
+	}
+
+	if spec == "balanced" {
+		counts := make([]float64, len(weights))
+		classes := 0.0
+		for _, i := range idx {
+			if counts[int(y[i])] == 0 {
+				classes++
+			}
+			counts[int(y[i])]++
+		}
+		for c, cnt := range counts {
+			if cnt > 0 {
+				weights[c] = float64(len(idx)) / (classes * cnt)
+			}
+		}
+		return weights, nil
+	}
+
+	for _, part := range SplitList(spec) {
+		sep := strings.LastIndexByte(part, ':')
+		if sep < 0 {
+			return nil, fmt.Errorf("bad class weight %q, expected class:weight", part)
+		}
+		class, ok := label.codes[strings.TrimSpace(part[:sep])]
+		if !ok {
+			return nil, fmt.Errorf("unknown class %q", part[:sep])
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(part[sep+1:]), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad class weight %q", part)
+		}
+		weights[class] = w
+	}
+	return weights, nil
+}
+
+// SampleWeights returns the weight of every row of the data: the weight of
+// the row times the weight of its class. Either can be nil, in which case it
+// counts as 1; nil is returned if both are
+func SampleWeights(rowWeights []float64, y []float64, classWeights []float64) []float64 {
+	if rowWeights == nil && classWeights == nil {
+		return nil
+	}
+	weights := make([]float64, len(y))
+	for i := range weights {
+		weights[i] = 1
+		if rowWeights != nil {
+			weights[i] = rowWeights[i]
+		}
+		if classWeights != nil {
+			weights[i] *= classWeights[int(y[i])]
+		}
+	}
+	return weights
+}
+
+// Function to print the weight of every class
+func PrintClassWeights(weights []float64, label Column) {
+	fmt.Printf("%-20s %10s\n", "class", "weight")
+	for c, w := range weights {
+		fmt.Printf("%-20s %10.4f\n", label.level(float64(c)), w)
+	}
+}